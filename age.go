@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+type ageBucket struct {
+	label string
+	max   time.Duration // 0 for the last, open ended bucket
+}
+
+var ageBuckets = []ageBucket{
+	{"< 1d", 24 * time.Hour},
+	{"1-7d", 7 * 24 * time.Hour},
+	{"7-30d", 30 * 24 * time.Hour},
+	{"> 30d", 0},
+}
+
+// ageBucketOf returns the index in ageBuckets for a file modified at mtime.
+func ageBucketOf(mtime, now time.Time) int {
+	age := now.Sub(mtime)
+	for i, b := range ageBuckets {
+		if b.max == 0 || age < b.max {
+			return i
+		}
+	}
+	return len(ageBuckets) - 1
+}
+
+// reportAges prints the number and size of the matches in each age bucket,
+// going by modification time.
+func (m metadata) reportAges(out io.Writer, now time.Time) error {
+	counts := make([]int64, len(ageBuckets))
+	sizes := make([]int64, len(ageBuckets))
+	for _, f := range m.fMeta {
+		i := ageBucketOf(f.modTime, now)
+		counts[i]++
+		sizes[i] += f.size
+	}
+
+	w := tabwriter.NewWriter(out, 12, 1, 3, ' ', 0)
+	fmt.Fprintf(w, "#\tAGE\tFILES\tSIZE\n")
+	fmt.Fprintf(w, "-\t---\t-----\t----\n")
+	for i, b := range ageBuckets {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", i+1, b.label, humanize.Comma(counts[i]), humanize.Bytes(uint64(sizes[i])))
+	}
+	fmt.Fprint(w, "\n")
+
+	return w.Flush()
+}
+
+// pickAges asks which age buckets to delete and narrows the matches to them.
+// It returns false if the user quit.
+func (m metadata) pickAges(reader *bufio.Reader, out io.Writer, now time.Time) (metadata, bool, error) {
+	for {
+		fmt.Fprintf(out, "delete the files in which age buckets? (e.g. 3,4; a for all, q to quit): ")
+
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			return m, false, fmt.Errorf("error reading selection: %w", err)
+		}
+		fmt.Fprint(out, "\n")
+
+		response = strings.ToLower(strings.TrimSpace(response))
+		switch response {
+		case "q":
+			return m, false, nil
+		case "a":
+			return m, true, nil
+		}
+
+		keep := make([]bool, len(ageBuckets))
+		valid := response != ""
+		for _, field := range strings.FieldsFunc(response, func(r rune) bool { return r == ',' || r == ' ' }) {
+			lo, hi, err := parseSelection(field, len(ageBuckets))
+			if err != nil {
+				fmt.Fprintf(out, "%v\n\n", err)
+				valid = false
+				break
+			}
+			for i := lo; i <= hi; i++ {
+				keep[i-1] = true
+			}
+		}
+		if !valid {
+			continue
+		}
+
+		for path, f := range m.fMeta {
+			if keep[ageBucketOf(f.modTime, now)] {
+				continue
+			}
+			if !m.noTotal {
+				m.total -= f.size
+			}
+			delete(m.fMeta, path)
+		}
+		return m, true, nil
+	}
+}
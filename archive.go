@@ -0,0 +1,142 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var archiveFormats = []string{"gzip", "zstd", "tar"}
+
+func validArchiveFormat(format string) error {
+	for _, f := range archiveFormats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("error invalid archive format %q: must be one of %v", format, archiveFormats)
+}
+
+// archive appends files to a tarball, compressed with gzip or zstd or not at
+// all, under their path relative to root, before removing them. It is safe
+// for concurrent use; files are written one at a time.
+type archive struct {
+	mu   sync.Mutex
+	root string
+	f    *os.File
+	// comp is the compressor between tw and f, or nil for a plain tarball.
+	comp io.WriteCloser
+	tw   *tar.Writer
+}
+
+func createArchive(path, root, format string) (*archive, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &archive{root: root, f: f}
+	switch format {
+	case "gzip":
+		a.comp = gzip.NewWriter(f)
+	case "zstd":
+		if a.comp, err = zstd.NewWriter(f); err != nil {
+			f.Close()
+			os.Remove(path)
+			return nil, err
+		}
+	}
+
+	if a.comp != nil {
+		a.tw = tar.NewWriter(a.comp)
+	} else {
+		a.tw = tar.NewWriter(f)
+	}
+	return a, nil
+}
+
+// remove adds path to the archive and then deletes it.
+func (a *archive) remove(path string) error {
+	if err := a.add(path); err != nil {
+		return err
+	}
+	return os.Remove(longPath(path))
+}
+
+func (a *archive) add(path string) error {
+	info, err := os.Lstat(longPath(path))
+	if err != nil {
+		return err
+	}
+
+	var link string
+	if info.Mode()&os.ModeSymlink != 0 {
+		if link, err = os.Readlink(longPath(path)); err != nil {
+			return err
+		}
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(a.root, path)
+	if err != nil {
+		return err
+	}
+	hdr.Name = filepath.ToSlash(rel)
+
+	var f *os.File
+	if hdr.Typeflag == tar.TypeReg {
+		if f, err = os.Open(longPath(path)); err != nil {
+			return err
+		}
+		defer f.Close()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if f != nil {
+		// Copy exactly the size in the header so that a file growing
+		// underneath us doesn't corrupt the rest of the archive.
+		if _, err := io.CopyN(a.tw, f, hdr.Size); err != nil {
+			return err
+		}
+	}
+
+	return a.tw.Flush()
+}
+
+// Close finishes the archive and returns its size on disk.
+func (a *archive) Close() (int64, error) {
+	err := a.tw.Close()
+	if a.comp != nil {
+		if cerr := a.comp.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	info, serr := a.f.Stat()
+	if cerr := a.f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = serr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
@@ -0,0 +1,12 @@
+//go:build !(linux || openbsd || darwin || freebsd || netbsd || windows)
+
+package main
+
+import (
+	"io/fs"
+	"time"
+)
+
+func accessTime(info fs.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isBrokenPipe reports whether err comes from writing to a pipe whose reader
+// has gone away. Writes to stdout and stderr normally end the process with
+// SIGPIPE first; this catches the rest.
+func isBrokenPipe(err error) bool {
+	return errors.Is(err, syscall.EPIPE)
+}
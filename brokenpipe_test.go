@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+// closedPipe returns the writing end of a pipe whose reader has gone away,
+// like the stdout of delly piped into head once head has exited.
+func closedPipe(t *testing.T) *os.File {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+func TestIsBrokenPipe(t *testing.T) {
+	w := closedPipe(t)
+	_, err := w.Write([]byte("x"))
+	if err == nil {
+		t.Fatal("write to a closed pipe succeeded")
+	}
+	if !isBrokenPipe(err) {
+		t.Errorf("isBrokenPipe(%v) = false", err)
+	}
+	if !isBrokenPipe(fmt.Errorf("error writing report: %w", err)) {
+		t.Errorf("isBrokenPipe does not see through wrapping")
+	}
+	if isBrokenPipe(errors.New("error something else")) || isBrokenPipe(os.ErrPermission) {
+		t.Errorf("isBrokenPipe matches errors other than a broken pipe")
+	}
+}
+
+func TestReportIntoClosedPipe(t *testing.T) {
+	root := t.TempDir()
+	files := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		files[fmt.Sprintf("f%03d.log", i)] = "log"
+	}
+	writeFiles(t, root, files)
+
+	app := newApp()
+	app.Reader = strings.NewReader("y\n")
+	app.Writer = closedPipe(t)
+	app.ExitErrHandler = func(*cli.Context, error) {}
+	err := app.Run([]string{"delly", "-e", "log", root})
+	if !isBrokenPipe(err) {
+		t.Fatalf("reporting into a closed pipe returned %v, want a broken pipe error", err)
+	}
+
+	// Nothing is deleted once the reader of the report is gone.
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(files) {
+		t.Errorf("%d of %d files left after the pipe closed", len(entries), len(files))
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// errorNoData is ERROR_NO_DATA, "The pipe is being closed.", which Windows
+// returns for writes to a pipe whose reader has gone away.
+const errorNoData = syscall.Errno(232)
+
+// isBrokenPipe reports whether err comes from writing to a pipe whose reader
+// has gone away. Windows has no SIGPIPE, so this is the only way a report
+// piped into something like head notices.
+func isBrokenPipe(err error) bool {
+	return errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ERROR_BROKEN_PIPE) || errors.Is(err, errorNoData)
+}
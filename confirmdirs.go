@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// confirmByDir asks about the matches one directory at a time: y deletes
+// the directory's files, n keeps them, a deletes them and those of every
+// remaining directory, and q keeps the files of every remaining directory.
+// It returns the matches narrowed to the approved directories.
+func (m metadata) confirmByDir(reader *bufio.Reader, out io.Writer, opts listOptions) (metadata, error) {
+	byDir := make(map[string]fileMap)
+	for path, f := range m.fMeta {
+		dir := filepath.Dir(path)
+		if byDir[dir] == nil {
+			byDir[dir] = make(fileMap)
+		}
+		byDir[dir][path] = f
+	}
+
+	dirs := make([]string, 0, len(byDir))
+	for dir := range byDir {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	var answer byte
+	for _, dir := range dirs {
+		files := byDir[dir]
+
+		if answer != 'a' && answer != 'q' {
+			var total int64
+			for _, f := range files {
+				total += f.size
+			}
+			fmt.Fprintf(out, "%s\n", opts.display(dir))
+			if err := files.report(out, total, opts); err != nil {
+				return m, err
+			}
+
+			var err error
+			answer, err = askForChoice(reader, out, "delete the files in this directory?", "ynaq")
+			if err != nil {
+				return m, err
+			}
+		}
+
+		if answer == 'n' || answer == 'q' {
+			for path, f := range files {
+				if !m.noTotal {
+					m.total -= f.size
+				}
+				delete(m.fMeta, path)
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// askForChoice asks s until the answer is one of the letters in choices and
+// returns that letter.
+func askForChoice(reader *bufio.Reader, out io.Writer, s, choices string) (byte, error) {
+	prompt := strings.Join(strings.Split(choices, ""), "/")
+	for {
+		fmt.Fprintf(out, "%s [%s]: ", s, prompt)
+
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			return 0, fmt.Errorf("error reading confirmation: %w", err)
+		}
+
+		response = strings.ToLower(strings.TrimSpace(response))
+
+		fmt.Fprint(out, "\n")
+
+		if len(response) == 1 && strings.Contains(choices, response) {
+			return response[0], nil
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+func (f fileMap) reportCSV(out io.Writer, opts listOptions) error {
+	w := csv.NewWriter(out)
+	if err := w.Write([]string{"path", "size", "mtime"}); err != nil {
+		return err
+	}
+
+	for _, k := range f.sorted(opts.sortKey, opts.reverse) {
+		record := []string{
+			opts.display(k),
+			strconv.FormatInt(f[k].size, 10),
+			f[k].modTime.Format(time.RFC3339),
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+func (f fileMap) byExt(opts listOptions) map[string]fileMap {
+	groups := make(map[string]fileMap)
+	for path, meta := range f {
+		ext := opts.ext(path)
+		if groups[ext] == nil {
+			groups[ext] = make(fileMap)
+		}
+		groups[ext][path] = meta
+	}
+	return groups
+}
+
+// writeExtReports writes one CSV report per extension into dir, named
+// report-<ext>.csv, or report-noext.csv for files without an extension.
+func (f fileMap) writeExtReports(dir string, opts listOptions) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	for ext, group := range f.byExt(opts) {
+		name := "report-noext.csv"
+		if ext != "" {
+			name = fmt.Sprintf("report-%s.csv", ext)
+		}
+
+		out, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+
+		err = group.reportCSV(out, opts)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
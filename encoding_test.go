@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+const invalidName = "bad\xff\xfe.log"
+
+func TestNameQuotesInvalidUTF8(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  bool
+		want string
+	}{
+		{"app.log", false, "app.log"},
+		{"café.log", false, "café.log"},
+		{invalidName, false, `"bad\xff\xfe.log"`},
+		{invalidName, true, invalidName},
+	}
+	for _, tt := range tests {
+		if got := (listOptions{rawNames: tt.raw}).name(tt.name); got != tt.want {
+			t.Errorf("name(%q) with raw %v = %q, want %q", tt.name, tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestFileReportQuotesInvalidUTF8(t *testing.T) {
+	path := "/data/" + invalidName
+	f := fileMap{path: {size: 3}}
+
+	var out strings.Builder
+	if err := f.report(&out, 3, listOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !utf8.ValidString(out.String()) {
+		t.Errorf("report is not valid UTF-8:\n%q", out.String())
+	}
+	if !strings.Contains(out.String(), strconv.Quote(path)) {
+		t.Errorf("report does not quote %q:\n%s", path, out.String())
+	}
+}
+
+func TestHistoryRoundTripsInvalidUTF8Root(t *testing.T) {
+	root := "/srv/" + invalidName
+	history := filepath.Join(t.TempDir(), "history.jsonl")
+	m := metadata{dMeta: dirMap{root: {bytesDeleted: 3, filesDeleted: 1}}, deleted: 1}
+	if err := m.appendHistory(history, root, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !utf8.Valid(data) {
+		t.Errorf("history is not valid UTF-8: %q", data)
+	}
+	var e map[string]any
+	if err := json.Unmarshal(bytes.TrimSpace(data), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e["root_base64"] == nil {
+		t.Errorf("history entry has no root_base64: %s", data)
+	}
+
+	var out strings.Builder
+	if err := reportHistory(&out, history); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), strconv.Quote(root)) {
+		t.Errorf("history report does not show the original root %q:\n%s", root, out.String())
+	}
+}
+
+func TestInvalidUTF8FileNamesAreReportedAndDeleted(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, invalidName)
+	// Windows and macOS refuse names that are not valid UTF-8.
+	if err := os.WriteFile(path, []byte("abc"), 0o644); err != nil {
+		t.Skipf("cannot create a file with an invalid UTF-8 name: %v", err)
+	}
+
+	out, err := runDelly(t, "y\n", "-e", "log", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !utf8.ValidString(out) {
+		t.Errorf("output is not valid UTF-8:\n%q", out)
+	}
+	if !strings.Contains(out, strconv.Quote(path)) {
+		t.Errorf("output does not quote %q:\n%s", path, out)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("%q was not deleted: %v", path, err)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dustin/go-humanize"
+)
+
+// estimateSampleEvery is how many matches of an extension share one stat
+// call in --estimate mode.
+const estimateSampleEvery = 10
+
+type extEstimate struct {
+	files   int64
+	sampled int64
+	bytes   int64
+}
+
+// size extrapolates the average size of the sampled files to all of them.
+func (e extEstimate) size() int64 {
+	if e.sampled == 0 {
+		return 0
+	}
+	return int64(float64(e.bytes) / float64(e.sampled) * float64(e.files))
+}
+
+// estimateByExt walks rootdir reading directory entries only and stats one
+// in every estimateSampleEvery matches of each extension. Only the extension
+// filter of opts is applied; the result is a ballpark figure, not a plan.
+func estimateByExt(ctx context.Context, rootdir string, opts walkOptions) (map[string]*extEstimate, error) {
+	est := make(map[string]*extEstimate)
+
+	err := filepath.WalkDir(rootdir, func(path string, d fs.DirEntry, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if ok, negated := matchExt(d.Name(), opts.exts, opts.extCaseFold); negated || ok == opts.invert {
+			return nil
+		}
+
+		ext := fileExt(path)
+		if opts.extCaseFold {
+			ext = strings.ToLower(ext)
+		}
+		e := est[ext]
+		if e == nil {
+			e = &extEstimate{}
+			est[ext] = e
+		}
+
+		if e.files%estimateSampleEvery == 0 {
+			if info, err := d.Info(); err == nil {
+				e.sampled++
+				e.bytes += info.Size()
+			}
+		}
+		e.files++
+
+		return nil
+	})
+
+	return est, err
+}
+
+func reportEstimate(out io.Writer, est map[string]*extEstimate) error {
+	exts := make([]string, 0, len(est))
+	var files, total int64
+	for ext, e := range est {
+		exts = append(exts, ext)
+		files += e.files
+		total += e.size()
+	}
+	sort.Strings(exts)
+
+	w := tabwriter.NewWriter(out, 12, 1, 3, ' ', 0)
+	fmt.Fprintf(w, "EXT\tFILES\tESTIMATED SIZE\n")
+	fmt.Fprintf(w, "---\t-----\t--------------\n")
+	for _, ext := range exts {
+		name := ext
+		if name == "" {
+			name = "(none)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t~%s\n", name, humanize.Comma(est[ext].files), humanize.Bytes(uint64(est[ext].size())))
+	}
+	fmt.Fprintf(w, "---\t-----\t--------------\n")
+	fmt.Fprintf(w, "TOTAL\t%s\t~%s\n\n", humanize.Comma(files), humanize.Bytes(uint64(total)))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "This is an estimate from the sizes of 1 in %d files; filters other than --ext and per-directory rules are not applied.\n", estimateSampleEvery)
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxBraceDepth limits how deeply brace expressions in --ext may be nested.
+const maxBraceDepth = 3
+
+// normalizeExts turns the raw --ext values into the list of extensions to
+// match. Each value is split on commas that are not inside braces and brace
+// expressions are expanded, so "log,{jpg,jp{e,}g}" yields log, jpg, jpeg and
+// jpg. Whitespace around extensions is trimmed and empty ones are dropped, so
+// "log, tmp ," is just log and tmp rather than also matching files without
+// an extension.
+func normalizeExts(values []string) ([]string, error) {
+	var exts []string
+	for _, v := range values {
+		for _, tok := range splitTopLevel(v) {
+			expanded, err := expandBraces(tok)
+			if err != nil {
+				return nil, err
+			}
+			for _, ext := range expanded {
+				if ext = strings.TrimSpace(ext); ext != "" {
+					exts = append(exts, ext)
+				}
+			}
+		}
+	}
+	return exts, nil
+}
+
+// readExts replaces every "-" among the --ext values with the values read
+// from r, separated by whitespace. Each of those may in turn hold comma
+// separated extensions or brace expressions.
+func readExts(values []string, r io.Reader) ([]string, bool, error) {
+	var (
+		out   []string
+		stdin bool
+	)
+	for _, v := range values {
+		if v != "-" {
+			out = append(out, v)
+			continue
+		}
+		if stdin {
+			continue
+		}
+		stdin = true
+
+		scanner := bufio.NewScanner(r)
+		scanner.Split(bufio.ScanWords)
+		for scanner.Scan() {
+			out = append(out, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, false, fmt.Errorf("error reading extensions from stdin: %w", err)
+		}
+	}
+	return out, stdin, nil
+}
+
+func splitTopLevel(s string) []string {
+	var (
+		parts []string
+		depth int
+		start int
+	)
+	for i, r := range s {
+		switch r {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func expandBraces(s string) ([]string, error) {
+	open := strings.IndexByte(s, '{')
+	if open < 0 {
+		if strings.IndexByte(s, '}') >= 0 {
+			return nil, fmt.Errorf("error invalid extension %q: unbalanced braces", s)
+		}
+		return []string{s}, nil
+	}
+
+	depth, maxDepth, end := 0, 0, -1
+	for i := open; i < len(s) && end < 0; i++ {
+		switch s[i] {
+		case '{':
+			depth++
+			if depth > maxDepth {
+				maxDepth = depth
+			}
+		case '}':
+			depth--
+			if depth == 0 {
+				end = i
+			}
+		}
+	}
+	if end < 0 {
+		return nil, fmt.Errorf("error invalid extension %q: unbalanced braces", s)
+	}
+	if maxDepth > maxBraceDepth {
+		return nil, fmt.Errorf("error invalid extension %q: braces may be nested at most %d levels deep", s, maxBraceDepth)
+	}
+
+	prefix, suffix := s[:open], s[end+1:]
+
+	var out []string
+	for _, alt := range splitTopLevel(s[open+1 : end]) {
+		expanded, err := expandBraces(prefix + alt + suffix)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, expanded...)
+	}
+	return out, nil
+}
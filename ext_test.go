@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeExts(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   []string
+	}{
+		{[]string{"log, tmp , bak"}, []string{"log", "tmp", "bak"}},
+		{[]string{"log", "tmp", "bak"}, []string{"log", "tmp", "bak"}},
+		{[]string{"log,tmp", "bak"}, []string{"log", "tmp", "bak"}},
+		{[]string{"log,,tmp,"}, []string{"log", "tmp"}},
+		{[]string{" {jpg, jpeg},png"}, []string{"jpg", "jpeg", "png"}},
+		{[]string{"log", "!important.log"}, []string{"log", "!important.log"}},
+	}
+	for _, tt := range tests {
+		got, err := normalizeExts(tt.values)
+		if err != nil {
+			t.Errorf("normalizeExts(%q): %v", tt.values, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("normalizeExts(%q) = %q, want %q", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestCommaSeparatedExtsDeleteEachExt(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a.log": "a",
+		"b.tmp": "b",
+		"c.bak": "c",
+		"d.txt": "d",
+	})
+
+	if _, err := runDelly(t, "y\n", "-e", "log, tmp , bak", root); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, kept := range map[string]bool{"a.log": false, "b.tmp": false, "c.bak": false, "d.txt": true} {
+		_, err := os.Lstat(filepath.Join(root, name))
+		if kept && err != nil {
+			t.Errorf("%s was deleted: %v", name, err)
+		}
+		if !kept && !os.IsNotExist(err) {
+			t.Errorf("%s was not deleted: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/dustin/go-humanize"
+)
+
+// extDirConflicts lists the flags that only know how to handle files, which
+// --include-dirs-by-ext would leave to handle whole directories, and those
+// that pick among the matched files after the walk, which cannot leave out
+// single files from a matched directory.
+var extDirConflicts = []string{
+	"trash", "quarantine-dir", "stage", "archive", "manifest", "invert", "resume",
+	"select", "batch-confirm", "age-report", "stream-delete", "emit-script",
+	"keep-newest", "limit", "target-free",
+}
+
+// extDir is a directory matched by --include-dirs-by-ext.
+type extDir struct {
+	size  int64
+	files int
+}
+
+// subtreeSize returns the total size and number of files below dir. refuse
+// is set to why dir must not be deleted whole when anything below it would
+// be spared by a file-by-file walk: a keep marker, a --rc-file that could
+// change the extensions, a directory on another filesystem, which deleting
+// dir recursively would reach into, or a file that opts would skip.
+func subtreeSize(dir string, info fs.FileInfo, opts walkOptions) (size int64, files int, refuse string, err error) {
+	// Everything below a matched directory goes whatever its extension, so
+	// files are only held to the other filters and to the exclusions.
+	filter := opts
+	filter.anyExt = true
+
+	dev, haveDev := deviceID(info)
+	err = filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if d, _ := deviceID(info); haveDev && d != dev {
+				refuse = "it reaches into another filesystem"
+				return filepath.SkipAll
+			}
+			if opts.keepMarker != "" {
+				if _, err := os.Lstat(filepath.Join(path, opts.keepMarker)); err == nil {
+					refuse = "it contains a keep marker"
+					return filepath.SkipAll
+				}
+			}
+			if opts.rcFile != "" {
+				if _, err := os.Lstat(filepath.Join(path, opts.rcFile)); err == nil {
+					refuse = "it contains a --rc-file"
+					return filepath.SkipAll
+				}
+			}
+			return nil
+		}
+		reason := filter.match(path, info)
+		if _, negated := matchExt(info.Name(), opts.exts, opts.extCaseFold); negated {
+			reason = skipNegated
+		}
+		if reason != matched {
+			refuse = fmt.Sprintf("it contains %s (%s)", path, reason)
+			return filepath.SkipAll
+		}
+		size += info.Size()
+		files++
+		return nil
+	})
+	return size, files, refuse, err
+}
+
+// extDirSize returns the total size of the directories matched by
+// --include-dirs-by-ext.
+func (m metadata) extDirSize() int64 {
+	var n int64
+	for _, d := range m.extDirs {
+		n += d.size
+	}
+	return n
+}
+
+// extDirFiles returns the number of files in the directories matched by
+// --include-dirs-by-ext.
+func (m metadata) extDirFiles() int {
+	var n int
+	for _, d := range m.extDirs {
+		n += d.files
+	}
+	return n
+}
+
+// reportExtDirs prints the directories matched by --include-dirs-by-ext with
+// the size and number of files of everything below them.
+func (m metadata) reportExtDirs(out io.Writer, opts listOptions) error {
+	dirs := make([]string, 0, len(m.extDirs))
+	var total int64
+	for path, d := range m.extDirs {
+		dirs = append(dirs, path)
+		total += d.size
+	}
+	sort.Strings(dirs)
+
+	rows := make([][2]string, len(dirs))
+	widths := [2]int{len("FILES"), len(humanize.Bytes(uint64(total)))}
+	for i, path := range dirs {
+		d := m.extDirs[path]
+		rows[i] = [2]string{humanize.Comma(int64(d.files)), humanize.Bytes(uint64(d.size))}
+		widths[0] = max(widths[0], len(rows[i][0]))
+		widths[1] = max(widths[1], len(rows[i][1]))
+	}
+
+	fmt.Fprintf(out, "%d directories match by extension and would be deleted with everything in them:\n", len(dirs))
+	w := tabwriter.NewWriter(out, 12, 1, 3, ' ', 0)
+	fmt.Fprintf(w, "DIRECTORY\t%s\t%s\n", padLeft("FILES", widths[0]), padLeft("SIZE", widths[1]))
+	fmt.Fprintf(w, "---------\t%s\t%s\n", padLeft("-----", widths[0]), padLeft("----", widths[1]))
+	for i, path := range dirs {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", opts.display(path), padLeft(rows[i][0], widths[0]), padLeft(rows[i][1], widths[1]))
+	}
+	fmt.Fprintf(w, "---------\t%s\t%s\n", padLeft("-----", widths[0]), padLeft("----", widths[1]))
+	fmt.Fprintf(w, "TOTAL\t%s\t%s\n", padLeft("", widths[0]), padLeft(humanize.Bytes(uint64(total)), widths[1]))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprint(out, "\n")
+	return nil
+}
+
+// deleteExtDirs deletes the directories matched by --include-dirs-by-ext
+// and everything in them, one after the other, and adds what they held to
+// the bytes and files deleted from their parent directory.
+func (m metadata) deleteExtDirs(ctx context.Context, prog *progress) metadata {
+	dirs := make([]string, 0, len(m.extDirs))
+	for path := range m.extDirs {
+		dirs = append(dirs, path)
+	}
+	sort.Strings(dirs)
+
+	for _, path := range dirs {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if err := os.RemoveAll(longPath(path)); err != nil {
+			slog.Error("error deleting directory", "path", path, "err", err)
+			if m.failed == nil {
+				m.failed = make(map[string]error)
+			}
+			m.failed[path] = err
+			continue
+		}
+
+		d := m.extDirs[path]
+		parent := filepath.Dir(path)
+		v := m.dMeta[parent]
+		v.bytesDeleted += d.size
+		v.filesDeleted += d.files
+		m.dMeta[parent] = v
+		m.dirsDeleted++
+		prog.dirDeleted(d.files, d.size)
+	}
+
+	return m
+}
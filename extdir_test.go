@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIncludeDirsByExtHonoursNegations(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"x.tmp":                   "x",
+		"build.tmp/important.log": "keep me",
+		"build.tmp/a.o":           "object",
+		"cache.tmp/b.o":           "object",
+	})
+
+	out, err := runDelly(t, "y\ny\n", "-e", "tmp,!important.log", "--include-dirs-by-ext", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"build.tmp/important.log", "build.tmp/a.o"} {
+		if _, err := os.Lstat(filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			t.Errorf("%s was deleted with its directory: %v", name, err)
+		}
+	}
+	for _, name := range []string{"x.tmp", "cache.tmp"} {
+		if _, err := os.Lstat(filepath.Join(root, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			t.Errorf("%s was not deleted: %v", name, err)
+		}
+	}
+	if strings.Contains(out, filepath.Join(root, "build.tmp")+" ") {
+		t.Errorf("build.tmp is listed as a matched directory:\n%s", out)
+	}
+}
+
+func TestIncludeDirsByExtHonoursFileFilters(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"cache.tmp/old.o": "old",
+		"cache.tmp/new.o": "new",
+	})
+	ref := filepath.Join(t.TempDir(), "ref")
+	writeFiles(t, filepath.Dir(ref), map[string]string{"ref": ""})
+
+	now := time.Now()
+	for name, mtime := range map[string]time.Time{
+		ref: now.Add(-time.Hour),
+		filepath.Join(root, "cache.tmp", "old.o"): now.Add(-2 * time.Hour),
+		filepath.Join(root, "cache.tmp", "new.o"): now,
+	} {
+		if err := os.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := runDelly(t, "", "-e", "tmp", "--include-dirs-by-ext", "--older-than-file", ref, root); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "cache.tmp", "new.o")); err != nil {
+		t.Errorf("file newer than --older-than-file was deleted with its directory: %v", err)
+	}
+}
+
+func TestIncludeDirsByExtSummaryCountsDirectories(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"x.tmp":         "12345",
+		"cache.tmp/b.o": "1234567890",
+	})
+
+	out, err := runDelly(t, "y\ny\n", "-e", "tmp", "--include-dirs-by-ext", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Freeing 15 B") {
+		t.Errorf("the summary leaves out the matched directory:\n%s", out)
+	}
+}
+
+func TestIncludeDirsByExtConflicts(t *testing.T) {
+	for _, args := range [][]string{
+		{"--keep-newest", "1"},
+		{"--limit", "tmp:1KB"},
+		{"--target-free", "1TB"},
+	} {
+		args = append([]string{"-e", "tmp", "--include-dirs-by-ext"}, append(args, t.TempDir())...)
+		if _, err := runDelly(t, "", args...); err == nil || !strings.Contains(err.Error(), "--include-dirs-by-ext cannot be combined") {
+			t.Errorf("%v: got %v, want a conflict", args, err)
+		}
+	}
+}
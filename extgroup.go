@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// builtinExtGroups are the extension groups --ext-group knows without a
+// groups file. Keep the README in sync when changing them.
+var builtinExtGroups = map[string][]string{
+	"images":    {"jpg", "jpeg", "png", "gif", "webp", "bmp", "tif", "tiff", "heic", "svg", "ico"},
+	"videos":    {"mp4", "mkv", "mov", "avi", "webm", "wmv", "flv", "m4v", "mpg", "mpeg"},
+	"audio":     {"mp3", "wav", "flac", "aac", "ogg", "opus", "m4a", "wma"},
+	"archives":  {"zip", "tar", "gz", "tgz", "bz2", "xz", "zst", "7z", "rar"},
+	"documents": {"pdf", "doc", "docx", "xls", "xlsx", "ppt", "pptx", "odt", "ods", "odp", "rtf"},
+	"temp":      {"tmp", "temp", "bak", "swp", "old"},
+}
+
+// defaultExtGroupsFile returns where custom extension groups are read from
+// unless --ext-groups-file says otherwise.
+func defaultExtGroupsFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "delly", "groups")
+}
+
+// loadExtGroups returns the built-in extension groups with the definitions
+// in the file at path applied on top. Each non-empty line not starting with
+// '#' has the form
+//
+//	raw = cr2,nef,arw   # define a group, replacing any group of that name
+//	images += avif      # add to a group
+//	images -= svg       # remove from a group
+//
+// Values accept the same comma and brace syntax as --ext, and comments as in
+// rule files. A missing file leaves the built-in groups as they are.
+func loadExtGroups(path string) (map[string][]string, error) {
+	groups := make(map[string][]string, len(builtinExtGroups))
+	for name, exts := range builtinExtGroups {
+		groups[name] = slices.Clone(exts)
+	}
+	if path == "" {
+		return groups, nil
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return groups, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, op, value, ok := splitRCLine(line)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("error %s:%d: expected <group> =, <group> += or <group> -=", path, n)
+		}
+
+		values, err := normalizeExts([]string{value})
+		if err != nil {
+			return nil, fmt.Errorf("error %s:%d: %w", path, n, err)
+		}
+
+		switch op {
+		case "=":
+			groups[name] = values
+		case "+=":
+			groups[name] = append(groups[name], values...)
+		case "-=":
+			groups[name] = slices.DeleteFunc(groups[name], func(e string) bool {
+				return slices.Contains(values, e)
+			})
+		}
+	}
+
+	return groups, scanner.Err()
+}
+
+// expandExtGroups returns the extensions of the named groups. Each value may
+// hold several comma separated names.
+func expandExtGroups(values []string, groups map[string][]string) ([]string, error) {
+	var exts []string
+	for _, v := range values {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+
+			group, ok := groups[name]
+			if !ok {
+				names := make([]string, 0, len(groups))
+				for n := range groups {
+					names = append(names, n)
+				}
+				sort.Strings(names)
+				return nil, fmt.Errorf("error unknown extension group %q: must be one of %v", name, names)
+			}
+			exts = append(exts, group...)
+		}
+	}
+	return exts, nil
+}
@@ -0,0 +1,25 @@
+//go:build !unix
+
+package main
+
+import "io/fs"
+
+// diskSize falls back to the apparent size where the allocated size is not
+// available.
+func diskSize(info fs.FileInfo) int64 {
+	return info.Size()
+}
+
+func fileID(info fs.FileInfo) (ino, nlink uint64) {
+	return 0, 0
+}
+
+func deviceID(info fs.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+const ownersSupported = false
+
+func fileOwner(info fs.FileInfo) (uint32, bool) {
+	return 0, false
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+
+	"github.com/dustin/go-humanize"
+)
+
+var flattenKeys = []string{"name", "hash"}
+
+func validFlattenKey(key string) error {
+	for _, k := range flattenKeys {
+		if k == key {
+			return nil
+		}
+	}
+	return fmt.Errorf("error invalid flatten key %q: must be one of %v", key, flattenKeys)
+}
+
+// flatGroup is a set of matches --flatten-report considers the same file.
+type flatGroup struct {
+	paths []string
+	size  int64
+	total int64
+}
+
+// reportFlattened prints the matches grouped by file rather than by path, so
+// that a file repeated across many directories takes one entry listing those
+// directories instead of one line per copy. With key "name" files are the
+// same when they have the same name and size; with "hash" when they have the
+// same contents, which reads every match once. Groups are listed by the
+// space they take up, largest first.
+func (m metadata) reportFlattened(out io.Writer, key string, opts listOptions) error {
+	groups := make(map[string]*flatGroup)
+	for path, f := range m.fMeta {
+		var id string
+		switch key {
+		case "name":
+			id = fmt.Sprintf("%s\x00%d", filepath.Base(path), f.size)
+		case "hash":
+			sum, err := hashFile(path)
+			switch {
+			case errors.Is(err, errNotRegular):
+				// Without contents, a file is only the same as itself.
+				id = "\x00" + path
+			case err != nil:
+				return fmt.Errorf("error --flatten-report: %w", err)
+			default:
+				id = sum
+			}
+		}
+
+		g := groups[id]
+		if g == nil {
+			g = &flatGroup{size: f.size}
+			groups[id] = g
+		}
+		g.paths = append(g.paths, path)
+		g.total += f.size
+	}
+
+	sorted := make([]*flatGroup, 0, len(groups))
+	for _, g := range groups {
+		sort.Strings(g.paths)
+		sorted = append(sorted, g)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].total != sorted[j].total {
+			return sorted[i].total > sorted[j].total
+		}
+		return sorted[i].paths[0] < sorted[j].paths[0]
+	})
+
+	// Copies with the same name are necessarily in different directories,
+	// copies with the same contents need not be.
+	copies := "dirs"
+	if key == "hash" {
+		copies = "copies"
+	}
+
+	for _, g := range sorted {
+		label := opts.name(filepath.Base(g.paths[0]))
+		for _, p := range g.paths[1:] {
+			if filepath.Base(p) != filepath.Base(g.paths[0]) {
+				label += " (and other names)"
+				break
+			}
+		}
+
+		if len(g.paths) == 1 {
+			fmt.Fprintf(out, "%s, %s\n", label, humanize.Bytes(uint64(g.size)))
+		} else {
+			fmt.Fprintf(out, "%s × %s %s, %s total (%s each)\n", label, humanize.Comma(int64(len(g.paths))), copies,
+				humanize.Bytes(uint64(g.total)), humanize.Bytes(uint64(g.size)))
+		}
+		for _, p := range g.paths {
+			detail := opts.display(filepath.Dir(p))
+			if key == "hash" && filepath.Base(p) != filepath.Base(g.paths[0]) {
+				detail = opts.display(p)
+			}
+			fmt.Fprintf(out, "  %s\n", detail)
+		}
+	}
+	fmt.Fprint(out, "\n")
+
+	if !opts.noTotal {
+		fmt.Fprintf(out, "TOTAL %s\n\n", humanize.Bytes(uint64(m.total)))
+	}
+
+	return nil
+}
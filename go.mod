@@ -4,11 +4,15 @@ go 1.21.1
 
 require (
 	github.com/dustin/go-humanize v1.0.1
+	github.com/klauspost/compress v1.17.11
 	github.com/urfave/cli/v2 v2.25.7
+	golang.org/x/term v0.27.0
+	golang.org/x/time v0.10.0
 )
 
 require (
 	github.com/cpuguy83/go-md2man/v2 v2.0.2 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
 	github.com/xrash/smetrics v0.0.0-20201216005158-039620a65673 // indirect
+	golang.org/x/sys v0.28.0 // indirect
 )
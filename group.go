@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+)
+
+var groupKeys = []string{"ext", "dir", "size"}
+
+func validGroupKey(key string) error {
+	for _, k := range groupKeys {
+		if k == key {
+			return nil
+		}
+	}
+	return fmt.Errorf("error invalid group key %q: must be one of %v", key, groupKeys)
+}
+
+// sizeBuckets are the upper bounds of the --group-by size groups; files of at
+// least the last bound fall into a final open ended group.
+var sizeBuckets = []int64{1e6, 100e6, 1e9}
+
+func sizeBucket(size int64) (int, string) {
+	lower := "0 B"
+	for i, upper := range sizeBuckets {
+		if size < upper {
+			return i, fmt.Sprintf("%s to %s", lower, humanize.Bytes(uint64(upper)))
+		}
+		lower = humanize.Bytes(uint64(upper))
+	}
+	return len(sizeBuckets), lower + " and over"
+}
+
+// reportGroups prints one file table per group of matches, each ending in the
+// group's subtotal, followed by the grand total. Directories are grouped by
+// their first path element below root.
+func (m metadata) reportGroups(out io.Writer, key, root string, opts listOptions) error {
+	groups := make(map[string]fileMap)
+	totals := make(map[string]int64)
+	order := make(map[string]int)
+
+	for path, f := range m.fMeta {
+		var name string
+		switch key {
+		case "ext":
+			name = opts.ext(path)
+			if name == "" {
+				name = "(no extension)"
+			}
+		case "dir":
+			name = "."
+			if rel, err := filepath.Rel(root, filepath.Dir(path)); err == nil && rel != "." {
+				name, _, _ = strings.Cut(rel, string(filepath.Separator))
+			}
+		case "size":
+			var i int
+			i, name = sizeBucket(f.size)
+			order[name] = i
+		}
+
+		if groups[name] == nil {
+			groups[name] = make(fileMap)
+		}
+		groups[name][path] = f
+		totals[name] += f.size
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if order[names[i]] != order[names[j]] {
+			return order[names[i]] < order[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	sub := opts
+	sub.totalLabel = "SUBTOTAL"
+	for _, name := range names {
+		files := "files"
+		if len(groups[name]) == 1 {
+			files = "file"
+		}
+		fmt.Fprintf(out, "== %s (%s %s) ==\n", opts.name(name), humanize.Comma(int64(len(groups[name]))), files)
+		if err := groups[name].report(out, totals[name], sub); err != nil {
+			return err
+		}
+	}
+
+	if !opts.noTotal {
+		fmt.Fprintf(out, "TOTAL %s\n\n", humanize.Bytes(uint64(m.total)))
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dustin/go-humanize"
+)
+
+// histogramBuckets are the upper bounds of the --histogram size ranges;
+// files of at least the last bound fall into a final open ended range.
+var histogramBuckets = []int64{1e3, 10e3, 1e6, 100e6, 1e9}
+
+// histogramWidth is the length of the bar of the fullest range.
+const histogramWidth = 40
+
+func histogramBucket(size int64) int {
+	for i, upper := range histogramBuckets {
+		if size < upper {
+			return i
+		}
+	}
+	return len(histogramBuckets)
+}
+
+func histogramLabel(i int) string {
+	if i == len(histogramBuckets) {
+		return humanize.Bytes(uint64(histogramBuckets[i-1])) + " and over"
+	}
+	lower := "0 B"
+	if i > 0 {
+		lower = humanize.Bytes(uint64(histogramBuckets[i-1]))
+	}
+	return fmt.Sprintf("%s to %s", lower, humanize.Bytes(uint64(histogramBuckets[i])))
+}
+
+// reportHistogram prints how many matches fall into each size range and how
+// much of the total they take up, with a bar scaled to the number of files,
+// to show whether the space goes to a few big files or many small ones.
+func (m metadata) reportHistogram(out io.Writer) error {
+	counts := make([]int64, len(histogramBuckets)+1)
+	sizes := make([]int64, len(histogramBuckets)+1)
+	var total, most int64
+	for _, f := range m.fMeta {
+		i := histogramBucket(f.size)
+		counts[i]++
+		sizes[i] += f.size
+		total += f.size
+		most = max(most, counts[i])
+	}
+
+	w := tabwriter.NewWriter(out, 12, 1, 3, ' ', 0)
+	fmt.Fprintf(w, "SIZE RANGE\tFILES\tSIZE\tSHARE\n")
+	fmt.Fprintf(w, "----------\t-----\t----\t-----\n")
+	for i := range counts {
+		var share float64
+		if total > 0 {
+			share = float64(sizes[i]) / float64(total) * 100
+		}
+		var bar string
+		if most > 0 {
+			n := int(counts[i] * histogramWidth / most)
+			if n == 0 && counts[i] > 0 {
+				n = 1
+			}
+			bar = strings.Repeat("#", n)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.0f%%\t%s\n", histogramLabel(i), humanize.Comma(counts[i]),
+			humanize.Bytes(uint64(sizes[i])), share, bar)
+	}
+	fmt.Fprint(w, "\n")
+
+	return w.Flush()
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dustin/go-humanize"
+)
+
+// historyEntry is one line of a --history file. Its fields follow the
+// --porcelain output and the same schemaVersion applies.
+type historyEntry struct {
+	SchemaVersion int       `json:"schema_version"`
+	Time          time.Time `json:"time"`
+	Root          string    `json:"root"`
+	// RootBase64 holds the exact bytes of a root that is not valid UTF-8,
+	// which JSON cannot represent; Root then has them replaced by U+FFFD.
+	RootBase64   string `json:"root_base64,omitempty"`
+	FilesMatched int    `json:"files_matched"`
+	BytesMatched int64  `json:"bytes_matched"`
+	FilesDeleted int    `json:"files_deleted"`
+	BytesFreed   int64  `json:"bytes_freed"`
+	Failures     int    `json:"failures"`
+}
+
+// appendHistory adds the results of this run to the JSON lines file at
+// path, leaving earlier entries untouched.
+func (m metadata) appendHistory(path, root string, now time.Time) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	e := historyEntry{
+		SchemaVersion: schemaVersion,
+		Time:          now,
+		Root:          root,
+		FilesMatched:  m.matched(),
+		BytesMatched:  m.total,
+		FilesDeleted:  m.deleted,
+		BytesFreed:    m.freed(),
+		Failures:      len(m.failed),
+	}
+	if !utf8.ValidString(root) {
+		e.RootBase64 = base64.StdEncoding.EncodeToString([]byte(root))
+	}
+
+	err = json.NewEncoder(f).Encode(e)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// reportHistory summarizes the runs recorded in a --history file per root
+// directory and overall.
+func reportHistory(out io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	type summary struct {
+		runs        int
+		first, last time.Time
+		deleted     int
+		freed       int64
+	}
+	var all summary
+	roots := make(map[string]*summary)
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var e historyEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("error reading %s:%d: %w", path, line, err)
+		}
+		if e.SchemaVersion != schemaVersion {
+			return fmt.Errorf("error reading %s:%d: unsupported schema version %d", path, line, e.SchemaVersion)
+		}
+		if e.RootBase64 != "" {
+			root, err := base64.StdEncoding.DecodeString(e.RootBase64)
+			if err != nil {
+				return fmt.Errorf("error reading %s:%d: invalid root_base64: %w", path, line, err)
+			}
+			e.Root = string(root)
+		}
+
+		if roots[e.Root] == nil {
+			roots[e.Root] = &summary{}
+		}
+		for _, s := range []*summary{&all, roots[e.Root]} {
+			if s.runs == 0 || e.Time.Before(s.first) {
+				s.first = e.Time
+			}
+			if e.Time.After(s.last) {
+				s.last = e.Time
+			}
+			s.runs++
+			s.deleted += e.FilesDeleted
+			s.freed += e.BytesFreed
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if all.runs == 0 {
+		fmt.Fprintln(out, "No runs recorded yet.")
+		return nil
+	}
+
+	names := make([]string, 0, len(roots))
+	for root := range roots {
+		names = append(names, root)
+	}
+	sort.Strings(names)
+
+	row := func(w io.Writer, name string, s *summary) {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", name, s.runs,
+			formatTime(s.first.Local()), formatTime(s.last.Local()),
+			humanize.Comma(int64(s.deleted)), humanize.Bytes(uint64(s.freed)))
+	}
+
+	w := tabwriter.NewWriter(out, 12, 1, 3, ' ', 0)
+	fmt.Fprintf(w, "DIRECTORY\tRUNS\tFIRST\tLAST\tFILES DELETED\tBYTES FREED\n")
+	fmt.Fprintf(w, "---------\t----\t-----\t----\t-------------\t-----------\n")
+	for _, root := range names {
+		row(w, listOptions{}.name(root), roots[root])
+	}
+	fmt.Fprintf(w, "---------\t----\t-----\t----\t-------------\t-----------\n")
+	row(w, "TOTAL", &all)
+	fmt.Fprint(w, "\n")
+
+	return w.Flush()
+}
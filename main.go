@@ -2,186 +2,2237 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
-	"log"
+	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"text/tabwriter"
+	"time"
+	"unicode/utf8"
 
 	"github.com/dustin/go-humanize"
 	"github.com/urfave/cli/v2"
 )
 
 type metadata struct {
-	dMeta dirMap
-	fMeta fileMap
-	total int64
+	dMeta   dirMap
+	fMeta   fileMap
+	total   int64
+	deleted int
+	failed  map[string]error
+	// changed lists the files left alone by --revalidate.
+	changed []string
+	// conflicts lists the files left in place by --on-conflict skip.
+	conflicts []string
+	// tooNew lists the files left alone because they were modified after
+	// the run started.
+	tooNew []string
+	// noTotal is set when total was not accumulated during the walk.
+	noTotal bool
+	// streamed counts the matches that --stream-delete handed straight to
+	// the deletion workers instead of keeping them in fMeta.
+	streamed int
+	// extDirs holds the directories matched by --include-dirs-by-ext,
+	// which are deleted whole after the files.
+	extDirs     map[string]extDir
+	dirsDeleted int
+}
+
+// matched returns the number of files matched by the walk.
+func (m metadata) matched() int {
+	return len(m.fMeta) + m.streamed
 }
 
 type (
 	dirMap  map[string]dirMeta
-	fileMap map[string]int64
+	fileMap map[string]fileMeta
 )
 
-type dirMeta struct {
-	size         int64
-	bytesDeleted int64
-}
+type fileMeta struct {
+	size int64
+	// disk is the space allocated to the file, which is less than size for
+	// sparse or compressed files.
+	disk       int64
+	modTime    time.Time
+	accessTime time.Time
+	mode       fs.FileMode
+	ino        uint64
+	nlink      uint64
+}
+
+func newFileMeta(info fs.FileInfo) fileMeta {
+	ino, nlink := fileID(info)
+	atime, _ := accessTime(info)
+	return fileMeta{
+		size:       info.Size(),
+		disk:       diskSize(info),
+		modTime:    info.ModTime(),
+		accessTime: atime,
+		mode:       info.Mode(),
+		ino:        ino,
+		nlink:      nlink,
+	}
+}
+
+// targetEnv names the environment variable holding the directory to clean
+// when none is given on the command line.
+const targetEnv = "DELLY_TARGET"
+
+// dryRunMatchesExitCode is the exit status of a --dry-run that found files
+// to delete, so that delly can be used to fail CI when junk is present.
+const dryRunMatchesExitCode = 10
+
+// brokenPipeExitCode is 128 plus SIGPIPE, the status a shell reports for a
+// process killed by writing to a closed pipe.
+const brokenPipeExitCode = 141
+
+// defaultConfirmPhraseAbove is the number of matches from which the user has
+// to type a phrase rather than y to confirm the deletion.
+const defaultConfirmPhraseAbove = 10000
+
+type walkOptions struct {
+	exts   []string
+	invert bool
+	sameFS bool
+	// extCaseFold matches extensions regardless of case.
+	extCaseFold bool
+
+	// filterOwner restricts matches to files owned by uid.
+	filterOwner bool
+	uid         uint32
+
+	// keepMarker protects the files of any directory containing a file of
+	// this name, or the whole subtree when keepSubtree is set.
+	keepMarker  string
+	keepSubtree bool
+
+	// protected holds the absolute paths of files that are never matched.
+	protected map[string]bool
+
+	// anyExt skips the extension check, for --resume without --ext.
+	anyExt bool
+
+	// extDirs also matches directories whose name has one of exts, which
+	// are not descended into.
+	extDirs bool
+
+	// statTimeout, when not zero, skips files whose info takes longer than
+	// this to fetch.
+	statTimeout time.Duration
+
+	// newerThan and olderThan, when not zero, bound the modification time
+	// of matched files.
+	newerThan time.Time
+	olderThan time.Time
+
+	// unusedSince, when not zero, only matches files last accessed before
+	// it.
+	unusedSince time.Time
+
+	// startedAt, when not zero, skips files modified after it.
+	startedAt time.Time
+
+	// brokenSymlinks matches dangling symlinks whatever their extension.
+	brokenSymlinks bool
+
+	// openFiles, when not nil, holds the device and inode of files open in
+	// other processes, which are never matched.
+	openFiles map[[2]uint64]bool
+
+	// newerSibling, when set, only matches files whose primary file with
+	// this extension exists and is newer.
+	newerSibling string
+
+	// mode, when not nil, restricts matches by permission bits.
+	mode *modeFilter
+
+	// rcFile is the name of per-directory rule files that change exts for
+	// the directory they are in and everything below it.
+	rcFile string
+
+	// noTotal skips accumulating the total size of the matches.
+	noTotal bool
+
+	// noKeep leaves matches out of fMeta and only counts them, for when
+	// onMatch hands them straight to the deletion workers.
+	noKeep bool
+
+	progress *progress
+
+	onMatch func(string, fileMeta)
+	onSkip  func(string, skipReason)
+}
+
+type listOptions struct {
+	sortKey    string
+	dirSortKey string
+	reverse    bool
+	hideBelow  int64
+	preview    int
+	showAtime  bool
+	noTotal    bool
+	// root, when set, is the directory paths are displayed relative to.
+	root string
+	// totalLabel replaces "TOTAL" at the bottom of the file table.
+	totalLabel string
+	// width is the terminal width paths are truncated to fit, or 0 to
+	// never truncate them.
+	width int
+	// extCaseFold lowercases extensions in extension-based output so that
+	// .JPG and .jpg files are counted together.
+	extCaseFold bool
+	// rawNames prints names that are not valid UTF-8 byte for byte instead
+	// of quoting them.
+	rawNames bool
+	// showDisk adds the allocated size on disk next to the apparent size.
+	showDisk bool
+	// mergeDirsBelow, when not 0, shows the directories fewer than this
+	// many files were deleted from as one row in the directory report.
+	mergeDirsBelow int
+}
+
+// display returns path as it should be shown to the user.
+func (o listOptions) display(path string) string {
+	if o.root != "" {
+		if rel, err := filepath.Rel(o.root, path); err == nil {
+			path = rel
+		}
+	}
+	return o.name(path)
+}
+
+// name returns a path or file name that is not valid UTF-8 quoted with Go
+// escapes, so that it cannot garble the terminal or the layout of a report,
+// and any other name as it is.
+func (o listOptions) name(s string) string {
+	if o.rawNames || utf8.ValidString(s) {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+// ext returns the extension of path as it should be shown and grouped by.
+func (o listOptions) ext(path string) string {
+	if o.extCaseFold {
+		return strings.ToLower(fileExt(path))
+	}
+	return fileExt(path)
+}
+
+type deleteOptions struct {
+	remove    func(string) error
+	workers   int
+	batchSize int
+	retries   int
+	manifest  *manifest
+	limiter   *rateLimiter
+	// revalidate skips files whose size or modification time changed since
+	// they were matched.
+	revalidate bool
+	// failFast stops handing out further deletions after the first failure
+	// other than the file already being gone.
+	failFast bool
+	// startedAt, when not zero, leaves alone files modified after it by
+	// the time they are deleted.
+	startedAt time.Time
+	progress  *progress
+}
+
+type dirMeta struct {
+	size         int64
+	bytesDeleted int64
+	filesDeleted int
+}
+
+func main() {
+	cli.VersionPrinter = func(ctx *cli.Context) {
+		printVersion(ctx.App.Writer)
+	}
+
+	app := newApp()
+	commandsFirst(app, os.Args)
+	if err := app.Run(os.Args); err != nil {
+		// The reader of a piped report, such as head, went away: stop
+		// quietly, as if killed by SIGPIPE.
+		if isBrokenPipe(err) {
+			os.Exit(brokenPipeExitCode)
+		}
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+// newApp returns the delly command line application.
+func newApp() *cli.App {
+	return &cli.App{
+		Usage:           "Delete files within a directory structure by file extensions",
+		UsageText:       "delly [options] <directory>\ndelly report <history file>\ndelly version",
+		Version:         version,
+		HideHelpCommand: true,
+		// --ext values are split on commas by normalizeExts so that commas
+		// inside brace expressions are preserved.
+		DisableSliceFlagSeparator: true,
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:    "ext",
+				Aliases: []string{"e"},
+				Usage:   "extensions to match, comma separated; brace expressions like '{jpg,jpeg,png}' are expanded and '!' excludes an extension or file name, e.g. '!important.log'; '-' reads them from stdin (required unless --broken-symlinks is given)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "ext-group",
+				Usage: "match the extensions of a named group, comma separated: images, videos, audio, archives, documents, temp or one from --ext-groups-file; merged with --ext",
+			},
+			&cli.StringFlag{
+				Name:  "ext-groups-file",
+				Value: defaultExtGroupsFile(),
+				Usage: "file defining custom extension groups, one '<group> = <extensions>' per line",
+			},
+			&cli.BoolFlag{
+				Name:  "ext-case-fold",
+				Usage: "match extensions regardless of case and lowercase them in extension-based reports",
+			},
+			&cli.BoolFlag{
+				Name:    "invert",
+				Aliases: []string{"keep-ext"},
+				Usage:   "delete every file whose extension is NOT given with --ext",
+			},
+			&cli.BoolFlag{
+				Name:    "same-fs",
+				Aliases: []string{"one-file-system"},
+				Usage:   "do not descend into directories on other filesystems (ignored on Windows)",
+			},
+			&cli.BoolFlag{
+				Name:  "broken-symlinks",
+				Usage: "also match symlinks whose target does not exist, whatever their extension",
+			},
+			&cli.DurationFlag{
+				Name:  "unused-for",
+				Usage: "only match files that have not been accessed for this long (e.g. 720h), going by access time rather than modification time",
+			},
+			&cli.BoolFlag{
+				Name:  "skip-open",
+				Usage: "skip files that other processes have open, such as live logs (Linux only, best-effort: other users' processes are only visible to root)",
+			},
+			&cli.StringFlag{
+				Name:  "newer-sibling",
+				Usage: "only match a file when its primary file with this extension is newer, e.g. report.csv for report.csv.bak or report.bak with --newer-sibling csv",
+			},
+			&cli.StringFlag{
+				Name:  "mode",
+				Usage: "only match files with exactly these octal permissions (e.g. 0777) or with any of these symbolic ones (e.g. +x, o+w)",
+			},
+			&cli.BoolFlag{
+				Name:  "owned-by-me",
+				Usage: "only match files owned by the current user (Unix only)",
+			},
+			&cli.UintFlag{
+				Name:  "uid",
+				Usage: "only match files owned by this user ID (Unix only)",
+			},
+			&cli.StringFlag{
+				Name:  "newer-than-file",
+				Usage: "only match files modified more recently than this file, like find -newer",
+			},
+			&cli.StringFlag{
+				Name:  "older-than-file",
+				Usage: "only match files modified before this file",
+			},
+			&cli.StringFlag{
+				Name:  "rc-file",
+				Usage: "name of per-directory files that change --ext for their subtree, e.g. .dellyrc; off unless given, since any file in the tree could widen what is deleted",
+			},
+			&cli.StringFlag{
+				Name:  "target-free",
+				Usage: "only delete the oldest matches needed to bring the free space of the filesystem up to this size (e.g. 20GB)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "limit",
+				Usage: "delete at most this much per extension, oldest files first, e.g. log:1GB,tmp:500MB; other extensions are not limited",
+			},
+			&cli.IntFlag{
+				Name:  "keep-newest",
+				Usage: "keep the N most recently modified matches across the whole tree and delete the rest",
+			},
+			&cli.StringFlag{
+				Name:  "keep-marker",
+				Value: ".delly-keep",
+				Usage: "never delete files in a directory containing a file with this name (empty disables markers)",
+			},
+			&cli.BoolFlag{
+				Name:  "include-dirs-by-ext",
+				Usage: "also match directories whose name has one of the extensions, such as build.tmp, and delete them with everything in them after asking separately",
+			},
+			&cli.StringFlag{
+				Name:  "protect-file",
+				Usage: "never delete the files listed in this file, one path per line, absolute or relative to the directory being scanned",
+			},
+			&cli.BoolFlag{
+				Name:  "keep-subtree",
+				Usage: "make keep markers protect every directory below them as well",
+			},
+			&cli.IntFlag{
+				Name:  "max-files",
+				Usage: "refuse to delete anything if more than this many files match (0 means no limit)",
+			},
+			&cli.StringFlag{
+				Name:  "sort",
+				Value: "path",
+				Usage: "order of the file listing: path, size or mtime (oldest first)",
+			},
+			&cli.StringFlag{
+				Name:  "sort-dirs",
+				Value: "path",
+				Usage: "order of the directory report: path or saved (fewest bytes saved first)",
+			},
+			&cli.IntFlag{
+				Name:  "merge-small-dirs",
+				Usage: "show the directories fewer than this many files were deleted from as a single row at the end of the directory report (0 lists each)",
+			},
+			&cli.BoolFlag{
+				Name:  "reverse",
+				Usage: "reverse the order of the file listing and the directory report",
+			},
+			&cli.BoolFlag{
+				Name:  "stream",
+				Usage: "print matched files as they are found instead of a sorted table",
+			},
+			&cli.BoolFlag{
+				Name:  "explain",
+				Usage: "print every file that was not matched and the reason it was excluded",
+			},
+			&cli.BoolFlag{
+				Name:  "trash",
+				Usage: "move matched files to the trash instead of deleting them",
+			},
+			&cli.StringFlag{
+				Name:  "trash-backend",
+				Value: defaultTrashBackend,
+				Usage: "trash implementation: gio (falls back to xdg when gio is not installed) or xdg; recyclebin or xdg on Windows",
+			},
+			&cli.StringSliceFlag{
+				Name:  "allow-dir",
+				Usage: "refuse to delete anything if a matched file is outside all of these directories (repeatable; not overridden by --force)",
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "go ahead when <directory> is a mount point, contains the current working directory or the delly binary is matched",
+			},
+			&cli.BoolFlag{
+				Name:  "confirm-phrase",
+				Usage: "confirm by typing a phrase such as 'DELETE 12 FILES' instead of y; always required with --invert",
+			},
+			&cli.IntFlag{
+				Name:  "confirm-phrase-above",
+				Value: defaultConfirmPhraseAbove,
+				Usage: "require the --confirm-phrase when at least this many files match (0 for never)",
+			},
+			&cli.BoolFlag{
+				Name:  "batch-confirm",
+				Usage: "confirm one directory at a time: y deletes its files, n keeps them, a deletes the rest, q keeps the rest",
+			},
+			&cli.BoolFlag{
+				Name:  "select",
+				Usage: "instead of a single yes/no question, pick the files to delete from a numbered list",
+			},
+			&cli.BoolFlag{
+				Name:  "estimate",
+				Usage: "quickly estimate the reclaimable space per extension by sampling file sizes, then exit without deleting anything",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "only report what would be deleted; exits with status 10 if anything matched and 0 otherwise",
+			},
+			&cli.BoolFlag{
+				Name:  "porcelain",
+				Usage: "print a stable, machine-parseable one line summary instead of the human readable reports",
+			},
+			&cli.BoolFlag{
+				Name:  "emit-script",
+				Usage: "instead of deleting, print a script of one delete command per matched file to review and run yourself; the reports are not printed",
+			},
+			&cli.StringFlag{
+				Name:  "script-shell",
+				Usage: "shell --emit-script writes for: sh or powershell",
+				Value: defaultScriptShell(),
+			},
+			&cli.BoolFlag{
+				Name:  "report-only-failures",
+				Usage: "print nothing unless some files could not be deleted, then list them; for cron jobs (logs only errors unless --log-level is given)",
+			},
+			&cli.BoolFlag{
+				Name:  "verify",
+				Usage: "compare the filesystem's free space before and after deletion with the bytes deleted",
+			},
+			&cli.StringFlag{
+				Name:  "log-level",
+				Value: "info",
+				Usage: "minimum level of log messages written to stderr: debug, info, warn or error",
+			},
+			&cli.StringFlag{
+				Name:  "log-format",
+				Value: "text",
+				Usage: "format of log messages: text or json",
+			},
+			&cli.StringFlag{
+				Name:    "confirm-input",
+				EnvVars: []string{"DELLY_CONFIRM_INPUT"},
+				Usage:   "read the answers to confirmation prompts from this file instead of stdin",
+			},
+			&cli.IntFlag{
+				Name:        "workers",
+				Usage:       "number of files deleted concurrently",
+				DefaultText: "chosen by --storage",
+			},
+			&cli.StringFlag{
+				Name:  "storage",
+				Value: "auto",
+				Usage: "storage type used to choose --workers: hdd (2 workers), ssd (one per CPU) or auto (detect on Linux, else ssd)",
+			},
+			&cli.Float64Flag{
+				Name:    "simulate-errors",
+				EnvVars: []string{"DELLY_SIMULATE_ERRORS"},
+				Hidden:  true,
+			},
+			&cli.IntFlag{
+				Name:   "batch-size",
+				Value:  64,
+				Hidden: true,
+			},
+			&cli.DurationFlag{
+				Name:  "max-runtime",
+				Usage: "stop scanning or deleting after this long (e.g. 30m) and report what was deleted so far",
+			},
+			&cli.DurationFlag{
+				Name:  "stat-timeout",
+				Usage: "skip files and directories whose information takes longer than this (e.g. 5s) to read, so that a hung network mount cannot stall the scan (0 waits forever)",
+			},
+			&cli.IntFlag{
+				Name:  "retries",
+				Usage: "retry deletions failing with transient errors (EBUSY, ETXTBSY, timeouts, and sharing or lock violations on Windows) up to this many times with exponential backoff",
+			},
+			&cli.StringFlag{
+				Name:  "rate-limit",
+				Usage: "delete at most this many files (e.g. 100/s) or bytes (e.g. 50MB/s) per second, shared by all workers",
+			},
+			&cli.StringFlag{
+				Name:  "history",
+				Usage: "append the results of this run to this JSON lines file; summarize it with 'delly report <file>'",
+			},
+			&cli.StringFlag{
+				Name:  "state-file",
+				Usage: "when deleting is interrupted (Ctrl-C, SIGTERM or --max-runtime), save the files not deleted yet to this file",
+			},
+			&cli.StringFlag{
+				Name:  "resume",
+				Usage: "delete the files saved to this --state-file instead of scanning <directory> again",
+			},
+			&cli.BoolFlag{
+				Name:  "exclude-newer-than-start",
+				Usage: "leave alone files modified after delly started, when scanning and again right before deleting each one, for directories other programs are writing to",
+			},
+			&cli.BoolFlag{
+				Name:  "revalidate",
+				Usage: "check each file again right before deleting it and leave it alone if its size or modification time changed",
+			},
+			&cli.BoolFlag{
+				Name:  "fail-fast",
+				Usage: "stop deleting as soon as one file cannot be deleted (files that are already gone don't count)",
+			},
+			&cli.StringFlag{
+				Name:  "save-plan",
+				Usage: "write the list of matched files to this file, e.g. with --dry-run, to check a later run against it with --compare-plan",
+			},
+			&cli.StringFlag{
+				Name:  "compare-plan",
+				Usage: "after deleting, report the differences between the files deleted and those in this --save-plan file",
+			},
+			&cli.StringFlag{
+				Name:  "manifest",
+				Usage: "write the path, SHA-256 hash and size of every deleted file to this file (reads each file once more before deleting it)",
+			},
+			&cli.BoolFlag{
+				Name:  "stage",
+				Usage: "move files to a staging directory first and ask again before deleting them for good, restoring them if declined",
+			},
+			&cli.StringFlag{
+				Name:  "archive",
+				Usage: "add matched files to this new tarball, under their path relative to <directory>, before deleting them",
+			},
+			&cli.StringFlag{
+				Name:  "archive-format",
+				Value: "gzip",
+				Usage: "compression of the --archive tarball: gzip, zstd (faster, usually smaller) or tar (none)",
+			},
+			&cli.StringFlag{
+				Name:  "quarantine-dir",
+				Usage: "move matched files into this directory, keeping their path relative to the scanned directory, instead of deleting them",
+			},
+			&cli.StringFlag{
+				Name:  "on-conflict",
+				Value: string(conflictRename),
+				Usage: "what --quarantine-dir does when a file is already there: rename (add a .N suffix), skip (leave the file in place) or overwrite",
+			},
+			&cli.StringFlag{
+				Name:  "hide-below",
+				Usage: "leave files smaller than this size (e.g. 1MB) out of the file table; they are still counted and deleted",
+			},
+			&cli.IntFlag{
+				Name:  "preview",
+				Usage: "only list the first N files in --sort order before asking for confirmation (0 lists all)",
+			},
+			&cli.BoolFlag{
+				Name:  "no-total",
+				Usage: "neither compute nor print the total size of the matches",
+			},
+			&cli.StringFlag{
+				Name:  "group-by",
+				Usage: "split the file report into sections with subtotals by ext, dir (top-level directory) or size",
+			},
+			&cli.BoolFlag{
+				Name:  "stream-delete",
+				Usage: "delete matches as they are found, without listing them or asking for confirmation, to keep memory use flat on huge trees (requires --force)",
+			},
+			&cli.BoolFlag{
+				Name:  "tree",
+				Usage: "show the matched files as a directory tree with subtotals instead of a table",
+			},
+			&cli.StringFlag{
+				Name:  "flatten-report",
+				Usage: "list files repeated across directories once, with the directories they are in, instead of a table: by name (name and size) or hash (contents, reads every match)",
+			},
+			&cli.BoolFlag{
+				Name:    "size-on-disk",
+				Aliases: []string{"apparent-vs-actual"},
+				Usage:   "show the space allocated on disk next to the apparent size of each file, which differ for sparse and compressed files",
+			},
+			&cli.StringFlag{
+				Name:  "report-encoding",
+				Value: "quote",
+				Usage: "how reports show names that are not valid UTF-8: quote (with Go escapes) or raw (byte for byte)",
+			},
+			&cli.BoolFlag{
+				Name:  "relative",
+				Usage: "show paths relative to <directory> instead of as absolute paths",
+			},
+			&cli.BoolFlag{
+				Name:  "show-atime",
+				Usage: "add the last access time of each file to the file table",
+			},
+			&cli.BoolFlag{
+				Name:  "age-report",
+				Usage: "show the count and size of the matches by age (<1d, 1-7d, 7-30d, >30d) and ask which ages to delete",
+			},
+			&cli.BoolFlag{
+				Name:  "histogram",
+				Usage: "show how many matches fall into each size range and their share of the total",
+			},
+			&cli.BoolFlag{
+				Name:  "projected-dirs",
+				Usage: "before asking for confirmation, show how much each directory would shrink",
+			},
+			&cli.IntFlag{
+				Name:  "preview-dirs",
+				Usage: "before asking for confirmation, show the N directories that would shrink the most",
+			},
+			&cli.StringFlag{
+				Name:  "output-dir",
+				Usage: "also write the matched files as one CSV report per extension (report-<ext>.csv) into this directory",
+			},
+			&cli.StringFlag{
+				Name:  "template",
+				Usage: "Go text/template evaluated once per matched file (fields: .Path, .Size, .HumanSize, .Dir, .Ext, .ModTime)",
+			},
+			&cli.StringFlag{
+				Name:  "summary-template",
+				Usage: "Go text/template evaluated once after the file list (fields: .Count, .Total, .HumanTotal)",
+			},
+		},
+		Before: func(ctx *cli.Context) error {
+			level := ctx.String("log-level")
+			if ctx.Bool("report-only-failures") && !ctx.IsSet("log-level") {
+				level = "error"
+			}
+			logger, err := newLogger(ctx.App.ErrWriter, level, ctx.String("log-format"))
+			if err != nil {
+				return err
+			}
+			slog.SetDefault(logger)
+			return nil
+		},
+		Commands: []*cli.Command{
+			{
+				Name:      "report",
+				Usage:     "summarize the runs recorded with --history",
+				ArgsUsage: "<history file>",
+				Action: func(ctx *cli.Context) error {
+					if ctx.Args().Len() != 1 {
+						return errors.New("error invalid args: exactly one history file must be provided")
+					}
+					return reportHistory(ctx.App.Writer, ctx.Args().First())
+				},
+			},
+			{
+				Name:  "version",
+				Usage: "print the version, commit and build date",
+				Action: func(ctx *cli.Context) error {
+					printVersion(ctx.App.Writer)
+					return nil
+				},
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			root := ctx.Args().First()
+			if ctx.Args().Len() == 0 {
+				root = os.Getenv(targetEnv)
+				if root != "" {
+					slog.Info("no directory given; using "+targetEnv, "dir", root)
+				}
+			}
+			if ctx.Args().Len() > 1 || root == "" {
+				return errors.New("error invalid args: exactly one argument must be provided, or " + targetEnv + " set to a directory")
+			}
+
+			values, extsFromStdin, err := readExts(ctx.StringSlice("ext"), ctx.App.Reader)
+			if err != nil {
+				return err
+			}
+			// The confirmation is read from stdin as well, and stdin has been
+			// read to the end by now.
+			if extsFromStdin && ctx.String("confirm-input") == "" && !ctx.Bool("dry-run") && !ctx.Bool("estimate") {
+				return errors.New("error invalid flags: --ext - reads stdin, so it needs --dry-run, --estimate or the answers in a --confirm-input file")
+			}
+
+			if names := ctx.StringSlice("ext-group"); len(names) > 0 {
+				groups, err := loadExtGroups(ctx.String("ext-groups-file"))
+				if err != nil {
+					return err
+				}
+				grouped, err := expandExtGroups(names, groups)
+				if err != nil {
+					return err
+				}
+				values = append(values, grouped...)
+			}
+
+			exts, err := normalizeExts(values)
+			if err != nil {
+				return err
+			}
+			if len(exts) == 0 && ctx.String("resume") == "" && (!ctx.Bool("broken-symlinks") || ctx.Bool("invert")) {
+				return errors.New("error invalid flags: --ext or --ext-group is required unless --broken-symlinks is given without --invert")
+			}
+			in := ctx.App.Reader
+			if path := ctx.String("confirm-input"); path != "" {
+				f, err := os.Open(path)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				in = f
+			}
+			// A single reader is shared by all roots so that answers
+			// buffered for one are not lost to the next.
+			reader := bufio.NewReader(in)
+
+			roots, err := expandRoot(root)
+			if err != nil {
+				return err
+			}
+			roots, resolved := dedupeRoots(roots)
+			if err := checkSingleRootFlags(ctx, root, roots); err != nil {
+				return err
+			}
+
+			// With several roots, quarantined files keep their path
+			// relative to the directory containing all of them, so that
+			// files at the same relative path in two roots don't collide.
+			var quarantineBase string
+			if len(roots) > 1 {
+				quarantineBase = commonDir(resolved)
+			}
+
+			// A --dry-run that matched files in one root should not stop
+			// the others from being listed.
+			var exit error
+			for _, root := range roots {
+				if len(roots) > 1 && !ctx.Bool("porcelain") && !ctx.Bool("report-only-failures") && !ctx.Bool("emit-script") {
+					fmt.Fprintf(ctx.App.Writer, "==> %s <==\n", root)
+				}
+
+				err := deleteUnder(ctx, root, quarantineBase, exts, reader)
+				var ec cli.ExitCoder
+				if errors.As(err, &ec) && ec.ExitCode() == dryRunMatchesExitCode {
+					exit = err
+					continue
+				}
+				if err != nil {
+					return err
+				}
+			}
+
+			return exit
+		},
+	}
+}
+
+// deleteUnder runs delly on a single root directory, from the walk to the
+// deletion and its reports, asking for confirmations on reader. Files moved
+// by --quarantine-dir keep their path relative to quarantineBase, or to the
+// root if it is empty.
+func deleteUnder(ctx *cli.Context, root, quarantineBase string, exts []string, reader *bufio.Reader) error {
+	// The root is made absolute so that reports, manifests and
+	// directory keys are the same whichever way it was given.
+	rootDir, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+
+	// Files written after this point, by programs still at work in the
+	// tree, are not what the user asked to clean up.
+	var startedAt time.Time
+	if ctx.Bool("exclude-newer-than-start") {
+		startedAt = time.Now()
+	}
+
+	list := listOptions{
+		sortKey:        ctx.String("sort"),
+		dirSortKey:     ctx.String("sort-dirs"),
+		mergeDirsBelow: ctx.Int("merge-small-dirs"),
+		reverse:        ctx.Bool("reverse"),
+		extCaseFold:    ctx.Bool("ext-case-fold"),
+		rawNames:       ctx.String("report-encoding") == "raw",
+		showDisk:       ctx.Bool("size-on-disk"),
+	}
+	out := ctx.App.Writer
+	promptOut := out
+
+	porcelain := ctx.Bool("porcelain")
+	if porcelain {
+		out = io.Discard
+		promptOut = ctx.App.ErrWriter
+	}
+
+	onlyFailures := ctx.Bool("report-only-failures")
+	if onlyFailures {
+		if porcelain {
+			return errors.New("error invalid flags: --report-only-failures and --porcelain cannot be used together")
+		}
+		out = io.Discard
+		promptOut = io.Discard
+	}
+
+	// The script takes the place of the reports on stdout so that it can
+	// be redirected to a file as it is.
+	emitScript := ctx.Bool("emit-script")
+	if emitScript {
+		for _, name := range []string{"porcelain", "report-only-failures", "dry-run", "compare-plan"} {
+			if ctx.IsSet(name) {
+				return fmt.Errorf("error invalid flags: --emit-script and --%s cannot be used together", name)
+			}
+		}
+		if err := validScriptShell(ctx.String("script-shell")); err != nil {
+			return err
+		}
+		out = io.Discard
+		promptOut = ctx.App.ErrWriter
+	}
+	list.width = terminalWidth(out)
+
+	if err := validSortKey(list.sortKey); err != nil {
+		return err
+	}
+	if err := validDirSortKey(list.dirSortKey); err != nil {
+		return err
+	}
+	if list.mergeDirsBelow < 0 {
+		return errors.New("error invalid flags: --merge-small-dirs must not be negative")
+	}
+	if enc := ctx.String("report-encoding"); enc != "quote" && enc != "raw" {
+		return fmt.Errorf("error invalid --report-encoding %q: must be quote or raw", enc)
+	}
+
+	var targetFree uint64
+	if v := ctx.String("target-free"); v != "" {
+		targetFree, err = humanize.ParseBytes(v)
+		if err != nil {
+			return fmt.Errorf("error invalid --target-free %q: %w", v, err)
+		}
+	}
+
+	limits, err := parseLimits(ctx.StringSlice("limit"))
+	if err != nil {
+		return err
+	}
+	if list.extCaseFold {
+		folded := make(map[string]int64, len(limits))
+		for ext, n := range limits {
+			folded[strings.ToLower(ext)] = n
+		}
+		limits = folded
+	}
+
+	if v := ctx.String("hide-below"); v != "" {
+		size, err := humanize.ParseBytes(v)
+		if err != nil {
+			return fmt.Errorf("error invalid --hide-below: %w", err)
+		}
+		list.hideBelow = int64(size)
+	}
+
+	list.preview = ctx.Int("preview")
+	list.showAtime = ctx.Bool("show-atime")
+	list.noTotal = ctx.Bool("no-total")
+
+	if info, err := os.Lstat(rootDir); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		resolved, err := filepath.EvalSymlinks(rootDir)
+		if err != nil {
+			return err
+		}
+		slog.Warn("root is a symlink, scanning its target instead", "root", rootDir, "target", resolved)
+		rootDir = resolved
+	}
+
+	if ctx.Bool("relative") {
+		list.root = rootDir
+	}
+
+	force := ctx.Bool("force")
+	if err := checkCWD(rootDir); err != nil {
+		if !force {
+			return err
+		}
+		slog.Warn("scanning a directory that contains the current working directory", "root", rootDir)
+	}
+	if err := checkMountPoint(rootDir); err != nil {
+		if !force {
+			return err
+		}
+		slog.Warn("scanning a mount point", "root", rootDir)
+	}
+
+	quarantineDir := ctx.String("quarantine-dir")
+	if quarantineDir != "" && ctx.Bool("trash") {
+		return errors.New("error invalid flags: --trash and --quarantine-dir cannot be used together")
+	}
+
+	stage := ctx.Bool("stage")
+	if stage && (quarantineDir != "" || ctx.Bool("trash")) {
+		return errors.New("error invalid flags: --stage cannot be combined with --trash or --quarantine-dir")
+	}
+
+	archivePath := ctx.String("archive")
+	if archivePath != "" && (stage || quarantineDir != "" || ctx.Bool("trash")) {
+		return errors.New("error invalid flags: --archive cannot be combined with --trash, --quarantine-dir or --stage")
+	}
+	if archivePath != "" {
+		if _, err := os.Lstat(archivePath); err == nil {
+			return fmt.Errorf("error archive %s already exists", archivePath)
+		}
+	}
+	if err := validArchiveFormat(ctx.String("archive-format")); err != nil {
+		return err
+	}
+
+	remove := func(path string) error {
+		return os.Remove(longPath(path))
+	}
+	if ctx.Bool("trash") {
+		trash, err := newTrasher(ctx.String("trash-backend"))
+		if err != nil {
+			return err
+		}
+		remove = trash
+	}
+	onConflict, err := parseConflictPolicy(ctx.String("on-conflict"))
+	if err != nil {
+		return err
+	}
+	if ctx.IsSet("on-conflict") && quarantineDir == "" {
+		return errors.New("error invalid flags: --on-conflict only applies to --quarantine-dir")
+	}
+	if quarantineBase == "" {
+		quarantineBase = rootDir
+	}
+	if quarantineDir != "" {
+		remove = newQuarantiner(quarantineBase, quarantineDir, onConflict)
+	}
+
+	if f := ctx.Float64("simulate-errors"); f < 0 || f > 1 {
+		return errors.New("error invalid flags: --simulate-errors must be between 0 and 1")
+	}
+
+	workers, batchSize := ctx.Int("workers"), ctx.Int("batch-size")
+	if !ctx.IsSet("workers") {
+		workers, err = defaultWorkers(ctx.String("storage"), rootDir)
+		if err != nil {
+			return err
+		}
+	}
+	if workers < 1 || batchSize < 1 {
+		return errors.New("error invalid flags: --workers and --batch-size must be at least 1")
+	}
+
+	limiter, err := parseRateLimit(ctx.String("rate-limit"))
+	if err != nil {
+		return err
+	}
+
+	fileTmpl, err := parseTemplate("template", ctx.String("template"), fileTemplateData{})
+	if err != nil {
+		return err
+	}
+
+	summaryTmpl, err := parseTemplate("summary-template", ctx.String("summary-template"), summaryTemplateData{})
+	if err != nil {
+		return err
+	}
+
+	if ctx.Bool("no-total") && (porcelain || summaryTmpl != nil) {
+		return errors.New("error invalid flags: --no-total cannot be combined with --porcelain or --summary-template")
+	}
+
+	stream := ctx.Bool("stream")
+	if stream && (fileTmpl != nil || summaryTmpl != nil) {
+		return errors.New("error invalid flags: --stream cannot be combined with --template or --summary-template")
+	}
+
+	groupBy := ctx.String("group-by")
+	if groupBy != "" {
+		if err := validGroupKey(groupBy); err != nil {
+			return err
+		}
+		if stream || fileTmpl != nil || summaryTmpl != nil {
+			return errors.New("error invalid flags: --group-by cannot be combined with --stream, --template or --summary-template")
+		}
+	}
+
+	tree := ctx.Bool("tree")
+	if tree && (stream || fileTmpl != nil || summaryTmpl != nil || groupBy != "") {
+		return errors.New("error invalid flags: --tree cannot be combined with --stream, --template, --summary-template or --group-by")
+	}
+
+	includeDirs := ctx.Bool("include-dirs-by-ext")
+	if includeDirs {
+		for _, name := range extDirConflicts {
+			if ctx.IsSet(name) {
+				return fmt.Errorf("error invalid flags: --include-dirs-by-ext cannot be combined with --%s", name)
+			}
+		}
+	}
+
+	flatten := ctx.String("flatten-report")
+	if flatten != "" {
+		if err := validFlattenKey(flatten); err != nil {
+			return err
+		}
+		if stream || fileTmpl != nil || summaryTmpl != nil || groupBy != "" || tree {
+			return errors.New("error invalid flags: --flatten-report cannot be combined with --stream, --template, --summary-template, --group-by or --tree")
+		}
+	}
+
+	var onMatch func(string, fileMeta)
+	if stream {
+		onMatch = func(path string, f fileMeta) {
+			fmt.Fprintf(out, "%s\t%s\n", list.display(path), humanize.Bytes(uint64(f.size)))
+		}
+	}
+
+	invert := ctx.Bool("invert")
+
+	var onSkip func(string, skipReason)
+	if ctx.Bool("explain") {
+		onSkip = func(path string, reason skipReason) {
+			fmt.Fprintf(out, "skipped %s: %s\n", list.display(path), reason)
+		}
+	}
+
+	prog := &progress{}
+	defer func() {
+		p := prog.snapshot()
+		slog.Debug("finished", "root", rootDir, "scanned", p.scanned, "matched", p.matched, "deleted", p.deleted, "freed", p.freed)
+	}()
+
+	walk := walkOptions{
+		exts:           exts,
+		invert:         invert,
+		extCaseFold:    ctx.Bool("ext-case-fold"),
+		sameFS:         ctx.Bool("same-fs"),
+		brokenSymlinks: ctx.Bool("broken-symlinks"),
+		keepMarker:     ctx.String("keep-marker"),
+		keepSubtree:    ctx.Bool("keep-subtree"),
+		rcFile:         ctx.String("rc-file"),
+		newerSibling:   strings.TrimPrefix(ctx.String("newer-sibling"), "."),
+		noTotal:        list.noTotal,
+		onMatch:        onMatch,
+		onSkip:         onSkip,
+		startedAt:      startedAt,
+		extDirs:        includeDirs,
+		statTimeout:    ctx.Duration("stat-timeout"),
+		progress:       prog,
+	}
+
+	if path := ctx.String("protect-file"); path != "" {
+		walk.protected, err = loadProtectList(path, rootDir)
+		if err != nil {
+			return fmt.Errorf("error --protect-file: %w", err)
+		}
+	}
+
+	if ref := ctx.String("newer-than-file"); ref != "" {
+		info, err := os.Stat(ref)
+		if err != nil {
+			return fmt.Errorf("error --newer-than-file: %w", err)
+		}
+		walk.newerThan = info.ModTime()
+	}
+
+	if ref := ctx.String("older-than-file"); ref != "" {
+		info, err := os.Stat(ref)
+		if err != nil {
+			return fmt.Errorf("error --older-than-file: %w", err)
+		}
+		walk.olderThan = info.ModTime()
+	}
+
+	if d := ctx.Duration("unused-for"); d > 0 {
+		info, err := os.Stat(rootDir)
+		if err != nil {
+			return err
+		}
+		if _, ok := accessTime(info); !ok {
+			return errors.New("error --unused-for: access times are not available on this platform")
+		}
+		if noAtime(rootDir) {
+			return fmt.Errorf("error --unused-for: %s is on a filesystem mounted noatime, so access times are not updated", rootDir)
+		}
+		walk.unusedSince = time.Now().Add(-d)
+	}
+
+	if ctx.Bool("skip-open") {
+		if !openFilesSupported {
+			slog.Warn("--skip-open is only supported on Linux; ignoring")
+		} else {
+			walk.openFiles = openFiles()
+		}
+	}
+
+	walk.mode, err = parseModeFilter(ctx.String("mode"))
+	if err != nil {
+		return err
+	}
+
+	if ctx.Bool("owned-by-me") || ctx.IsSet("uid") {
+		if !ownersSupported {
+			slog.Warn("--owned-by-me and --uid are not supported on this platform; ignoring")
+		} else {
+			walk.filterOwner = true
+			walk.uid = uint32(os.Getuid())
+			if ctx.IsSet("uid") {
+				walk.uid = uint32(ctx.Uint("uid"))
+			}
+		}
+	}
+
+	var plan map[string]bool
+	if path := ctx.String("compare-plan"); path != "" {
+		if ctx.Bool("dry-run") {
+			return errors.New("error invalid flags: --compare-plan needs a run that deletes files, not --dry-run")
+		}
+		plan, err = readPlan(path, rootDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	runCtx := ctx.Context
+	if d := ctx.Duration("max-runtime"); d > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(runCtx, d)
+		defer cancel()
+	}
+
+	if ctx.Bool("estimate") {
+		est, err := estimateByExt(runCtx, rootDir, walk)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("error max runtime of %s exceeded while scanning %s", ctx.Duration("max-runtime"), rootDir)
+		}
+		if err != nil {
+			return err
+		}
+		return reportEstimate(out, est)
+	}
+
+	if ctx.Bool("stream-delete") {
+		if err := checkStreamDelete(ctx); err != nil {
+			return err
+		}
+		return streamDelete(ctx, runCtx, rootDir, quarantineBase, walk, deleteOptions{
+			remove:     remove,
+			workers:    workers,
+			batchSize:  batchSize,
+			retries:    ctx.Int("retries"),
+			limiter:    limiter,
+			revalidate: ctx.Bool("revalidate"),
+			failFast:   ctx.Bool("fail-fast"),
+			startedAt:  startedAt,
+			progress:   prog,
+		}, out, list)
+	}
+
+	var meta metadata
+	if resume := ctx.String("resume"); resume != "" {
+		meta, err = loadState(resume, rootDir, walk)
+		if err != nil {
+			return err
+		}
+	} else {
+		meta, err = collectDirMetadata(runCtx, rootDir, walk)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("error max runtime of %s exceeded while scanning %s", ctx.Duration("max-runtime"), rootDir)
+		}
+		if err != nil {
+			return err
+		}
+
+		if n := ctx.Int("keep-newest"); n > 0 {
+			meta = meta.keepNewest(n, onSkip)
+		}
+
+		if len(limits) > 0 {
+			meta = meta.limitPerExt(limits, list, onSkip)
+		}
+
+		if targetFree > 0 {
+			free, err := freeSpace(rootDir)
+			if err != nil {
+				return fmt.Errorf("error --target-free: %w", err)
+			}
+			need := int64(targetFree) - int64(free)
+			if need <= 0 {
+				fmt.Fprintf(out, "%s is free, which already meets --target-free %s. Exiting...\n",
+					humanize.Bytes(free), humanize.Bytes(targetFree))
+				return nil
+			}
+			meta = meta.keepForTarget(need, onSkip)
+			if !list.noTotal && meta.total < need {
+				slog.Warn("deleting every match will not reach --target-free",
+					"short_by", humanize.Bytes(uint64(need-meta.total)))
+			}
+		}
+	}
+
+	if porcelain {
+		defer func() { meta.reportPorcelain(ctx.App.Writer) }()
+	}
+
+	if path := ctx.String("save-plan"); path != "" {
+		if err := meta.savePlan(path, rootDir); err != nil {
+			return fmt.Errorf("error saving plan: %w", err)
+		}
+	}
+
+	if emitScript {
+		return meta.writeScript(ctx.App.Writer, ctx.String("script-shell"), rootDir)
+	}
+
+	if len(meta.fMeta) == 0 && len(meta.extDirs) == 0 {
+		fmt.Fprintln(out, "There is nothing to delete. Exiting...")
+		if plan != nil {
+			if n := meta.reportPlanDiff(out, plan, list); n > 0 {
+				return fmt.Errorf("error %d files differ from the plan in %s", n, ctx.String("compare-plan"))
+			}
+		}
+		return nil
+	}
+
+	if len(meta.fMeta) == 0 {
+		// Only directories matched; they are listed below.
+	} else if stream {
+		if !list.noTotal {
+			fmt.Fprintf(out, "TOTAL\t%s\n", humanize.Bytes(uint64(meta.total)))
+		}
+		fmt.Fprint(out, "\n")
+	} else if fileTmpl != nil || summaryTmpl != nil {
+		if err := meta.reportTemplate(out, fileTmpl, summaryTmpl, list); err != nil {
+			return err
+		}
+	} else if groupBy != "" {
+		if err := meta.reportGroups(out, groupBy, rootDir, list); err != nil {
+			return err
+		}
+	} else if tree {
+		if err := meta.reportTree(out, rootDir, list); err != nil {
+			return err
+		}
+	} else if flatten != "" {
+		if err := meta.reportFlattened(out, flatten, list); err != nil {
+			return err
+		}
+	} else if err := meta.reportFileMetadata(out, list); err != nil {
+		return err
+	}
+
+	if len(meta.extDirs) > 0 {
+		if err := meta.reportExtDirs(out, list); err != nil {
+			return err
+		}
+	}
+
+	if dir := ctx.String("output-dir"); dir != "" {
+		if err := meta.fMeta.writeExtReports(dir, list); err != nil {
+			return fmt.Errorf("error writing reports: %w", err)
+		}
+	}
+
+	now := time.Now()
+	if ctx.Bool("age-report") {
+		if err := meta.reportAges(out, now); err != nil {
+			return err
+		}
+	}
+
+	if ctx.Bool("histogram") {
+		if err := meta.reportHistogram(out); err != nil {
+			return err
+		}
+	}
+
+	if ctx.Bool("projected-dirs") {
+		if err := meta.projectedDirs().report(out, list); err != nil {
+			return err
+		}
+	}
+
+	if n := ctx.Int("preview-dirs"); n > 0 {
+		dirs := meta.projectedDirs()
+		top := dirs.changed("saved", true)
+		if len(top) > n {
+			top = top[:n]
+		}
+		if err := dirs.reportDirs(out, top, nil, list); err != nil {
+			return err
+		}
+	}
+
+	if ctx.Bool("dry-run") {
+		return cli.Exit("", dryRunMatchesExitCode)
+	}
+
+	if allowed := ctx.StringSlice("allow-dir"); len(allowed) > 0 {
+		if err := meta.checkAllowed(rootDir, allowed); err != nil {
+			return err
+		}
+	}
+
+	if err := meta.checkExecutable(); err != nil {
+		if !force {
+			return err
+		}
+		slog.Warn("the delly binary will be deleted")
+	}
+
+	if max := ctx.Int("max-files"); max > 0 && len(meta.fMeta)+meta.extDirFiles() > max {
+		return fmt.Errorf("error too many files: %d files matched but --max-files is %d", len(meta.fMeta)+meta.extDirFiles(), max)
+	}
+
+	// --invert deletes everything but what was named, so it is always
+	// confirmed with the phrase: before picking files when they are picked
+	// interactively, otherwise instead of the usual question.
+	invertMsg := fmt.Sprintf("--invert is set: every file listed above (all files NOT matching %s) will be deleted.",
+		strings.Join(exts, ", "))
+	picking := ctx.Bool("select") || ctx.Bool("batch-confirm") || ctx.Bool("age-report")
+	if invert && picking {
+		confirm, err := askForPhrase(reader, promptOut, invertMsg, deletePhrase(len(meta.fMeta)))
+		if err != nil {
+			return err
+		}
+		if !confirm {
+			fmt.Fprintln(promptOut, "exiting...")
+			return nil
+		}
+	}
+
+	if ctx.Bool("select") && ctx.Bool("batch-confirm") {
+		return errors.New("error invalid flags: --select and --batch-confirm cannot be used together")
+	}
+
+	if ctx.Bool("age-report") {
+		var confirm bool
+		meta, confirm, err = meta.pickAges(reader, promptOut, now)
+		if err != nil {
+			return err
+		}
+		if !confirm || len(meta.fMeta) == 0 {
+			fmt.Fprintln(promptOut, "exiting...")
+			return nil
+		}
+	}
+
+	if ctx.Bool("batch-confirm") {
+		meta, err = meta.confirmByDir(reader, promptOut, list)
+		if err != nil {
+			return err
+		}
+		if len(meta.fMeta) == 0 {
+			fmt.Fprintln(promptOut, "exiting...")
+			return nil
+		}
+	} else if ctx.Bool("select") {
+		var confirm bool
+		meta, confirm, err = meta.selectFiles(reader, promptOut, list)
+		if err != nil {
+			return err
+		}
+		if !confirm || len(meta.fMeta) == 0 {
+			fmt.Fprintln(promptOut, "exiting...")
+			return nil
+		}
+	} else if len(meta.fMeta) > 0 {
+		if !list.noTotal {
+			moving := ctx.Bool("trash") || quarantineDir != ""
+			fmt.Fprintln(promptOut, confirmSummary(meta.total+meta.extDirSize(), rootDir, moving))
+		}
+		var confirm bool
+		if invert {
+			confirm, err = askForPhrase(reader, promptOut, invertMsg, deletePhrase(len(meta.fMeta)))
+		} else if above := ctx.Int("confirm-phrase-above"); ctx.Bool("confirm-phrase") || (above > 0 && len(meta.fMeta) >= above) {
+			confirm, err = askForPhrase(reader, promptOut, "do you want to go ahead with deleting these files?", deletePhrase(len(meta.fMeta)))
+		} else {
+			confirm, err = askForConfirmation(reader, promptOut, "do you want to go ahead with deleting these files?")
+		}
+		if err != nil {
+			return err
+		}
+		if !confirm {
+			fmt.Fprintln(promptOut, "exiting...")
+			return nil
+		}
+	}
+
+	if len(meta.extDirs) > 0 {
+		if len(meta.fMeta) == 0 && !list.noTotal {
+			fmt.Fprintln(promptOut, confirmSummary(meta.extDirSize(), rootDir, false))
+		}
+		msg := fmt.Sprintf("do you want to delete the %d directories listed above and everything in them?", len(meta.extDirs))
+		confirm, err := askForConfirmation(reader, promptOut, msg)
+		if err != nil {
+			return err
+		}
+		if !confirm {
+			meta.extDirs = nil
+			if len(meta.fMeta) == 0 {
+				fmt.Fprintln(promptOut, "exiting...")
+				return nil
+			}
+		}
+	}
+
+	verify := ctx.Bool("verify")
+	var freeBefore uint64
+	if verify {
+		freeBefore, err = freeSpace(rootDir)
+		if err != nil {
+			return fmt.Errorf("error verify: %w", err)
+		}
+	}
+
+	var staged *staging
+	if stage {
+		staged, err = newStaging(rootDir)
+		if err != nil {
+			return err
+		}
+		remove = staged.remove
+	}
+
+	var arc *archive
+	if archivePath != "" {
+		arc, err = createArchive(archivePath, rootDir, ctx.String("archive-format"))
+		if err != nil {
+			return fmt.Errorf("error creating archive: %w", err)
+		}
+		remove = arc.remove
+	}
 
-func main() {
-	app := &cli.App{
-		Usage:           "Delete files within a directory structure by file extensions",
-		UsageText:       "delly [global options] command [arguments...]",
-		HideHelpCommand: true,
-		Flags: []cli.Flag{
-			&cli.StringSliceFlag{
-				Name:     "ext",
-				Aliases:  []string{"e"},
-				Required: true,
-			},
-		},
-		Before: func(ctx *cli.Context) error {
-			args := ctx.Args()
-			if args.Len() != 1 {
-				return errors.New("error invalid args: exactly one argument must be provided")
-			}
-			return nil
-		},
-		Action: func(ctx *cli.Context) error {
-			exts := ctx.StringSlice("ext")
-			rootDir := ctx.Args().Get(0)
+	if f := ctx.Float64("simulate-errors"); f > 0 {
+		remove = simulateErrors(remove, f)
+	}
 
-			meta, err := collectDirMetadata(rootDir, exts)
-			if err != nil {
-				return err
-			}
+	var mf *manifest
+	if path := ctx.String("manifest"); path != "" {
+		mf, err = createManifest(path)
+		if err != nil {
+			return err
+		}
+	}
 
-			if meta.total == 0 {
-				fmt.Println("There is nothing to delete. Exiting...")
-				return nil
-			}
+	stateFile := ctx.String("state-file")
+	if stateFile != "" {
+		// Stop deleting on Ctrl-C or SIGTERM like on --max-runtime,
+		// so that the files left over can be saved.
+		var stop context.CancelFunc
+		runCtx, stop = signal.NotifyContext(runCtx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+	}
 
-			if err := meta.reportFileMetadata(); err != nil {
-				return err
-			}
+	meta = deleteFilesByExtension(runCtx, meta, deleteOptions{
+		remove:     remove,
+		workers:    workers,
+		batchSize:  batchSize,
+		retries:    ctx.Int("retries"),
+		manifest:   mf,
+		limiter:    limiter,
+		revalidate: ctx.Bool("revalidate"),
+		failFast:   ctx.Bool("fail-fast"),
+		startedAt:  startedAt,
+		progress:   prog,
+	})
+	if len(meta.failed) == 0 || !ctx.Bool("fail-fast") {
+		meta = meta.deleteExtDirs(runCtx, prog)
+	}
+	meta.reconcile(prog)
 
-			confirm := askForConfirmation("do you want to go ahead with deleting these files?")
+	if mf != nil {
+		if err := mf.Close(); err != nil {
+			return fmt.Errorf("error writing manifest: %w", err)
+		}
+	}
 
-			if !confirm {
-				fmt.Println("exiting...")
-				return nil
-			}
+	if err := meta.reportDirMetadata(out, list); err != nil {
+		return err
+	}
 
-			meta, err = deleteFilesByExtension(meta)
-			if err != nil {
+	reportPaths(out, "files changed since they were matched and were not deleted", meta.changed, list)
+	reportPaths(out, "files were left in place because their destination already exists", meta.conflicts, list)
+	reportPaths(out, "files were modified after delly started and were not deleted", meta.tooNew, list)
+
+	if meta.dirsDeleted > 0 {
+		fmt.Fprintf(out, "%d directories were deleted with everything in them\n\n", meta.dirsDeleted)
+	}
+
+	if arc != nil {
+		size, err := arc.Close()
+		if err != nil {
+			return fmt.Errorf("error writing archive: %w", err)
+		}
+		var ratio string
+		if freed := meta.freed(); freed > 0 {
+			ratio = fmt.Sprintf(", %.1f%% of the original size", float64(size)/float64(freed)*100)
+		}
+		fmt.Fprintf(out, "%d files (%s) archived to %s (%s%s)\n\n",
+			meta.deleted, humanize.Bytes(uint64(meta.freed())), archivePath, humanize.Bytes(uint64(size)), ratio)
+	}
+
+	if staged != nil {
+		confirm, err := askForConfirmation(reader, promptOut,
+			fmt.Sprintf("files are staged in %s. permanently delete them? (n restores them)", staged.dir))
+		if err != nil {
+			return err
+		}
+
+		if confirm {
+			if err := staged.commit(); err != nil {
 				return err
 			}
-
-			if err := meta.reportDirMetadata(); err != nil {
+		} else {
+			if err := staged.restore(); err != nil {
 				return err
 			}
+			fmt.Fprintf(out, "%d files restored\n\n", meta.deleted)
+			meta = meta.undoDeletions()
+		}
+	}
 
-			return nil
-		},
+	if quarantineDir != "" {
+		fmt.Fprintf(out, "%d files moved to %s, keeping their paths relative to %s\n\n",
+			meta.deleted, quarantineDir, quarantineBase)
 	}
 
-	if err := app.Run(os.Args); err != nil {
-		log.Fatal(err)
+	if verify {
+		freeAfter, err := freeSpace(rootDir)
+		if err != nil {
+			return fmt.Errorf("error verify: %w", err)
+		}
+		reportVerify(out, meta.freed(), freeBefore, freeAfter)
 	}
-}
 
-func (d dirMap) report() error {
-	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
-	fmt.Fprint(w, "DIRECTORY\tOLDSIZE\tNEWSIZE\tBYTES SAVED\n")
-	fmt.Fprint(w, "---------\t-------\t-------\t-----------\n")
-	for k, v := range d {
-		if v.bytesDeleted != 0 {
-			size := humanize.Bytes(uint64(v.size))
-			newsz := humanize.Bytes(uint64(v.size - v.bytesDeleted))
-			bytesSaved := humanize.Bytes(uint64(v.bytesDeleted))
+	var planDiffs int
+	if plan != nil {
+		planDiffs = meta.reportPlanDiff(out, plan, list)
+	}
 
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
-				k,
-				size,
-				newsz,
-				bytesSaved,
-			)
+	if path := ctx.String("history"); path != "" {
+		if err := meta.appendHistory(path, rootDir, time.Now()); err != nil {
+			return fmt.Errorf("error writing history: %w", err)
 		}
 	}
-	if err := w.Flush(); err != nil {
-		log.Fatal(err)
+
+	if runCtx.Err() != nil && stateFile != "" && meta.deleted < len(meta.fMeta) {
+		n, err := meta.saveState(stateFile, rootDir)
+		if err != nil {
+			return fmt.Errorf("error saving state: %w", err)
+		}
+		return fmt.Errorf("error interrupted: deleted %d of %d files; %d left, continue with --resume %s",
+			meta.deleted, len(meta.fMeta), n, stateFile)
+	}
+
+	if runCtx.Err() != nil && meta.deleted+len(meta.failed) < len(meta.fMeta) {
+		return fmt.Errorf("error max runtime of %s exceeded: deleted %d of %d files",
+			ctx.Duration("max-runtime"), meta.deleted, len(meta.fMeta))
+	}
+
+	if onlyFailures && len(meta.failed) > 0 {
+		if err := meta.reportFailures(ctx.App.Writer, list); err != nil {
+			return err
+		}
+	}
+
+	if len(meta.failed) > 0 && ctx.Bool("fail-fast") {
+		return fmt.Errorf("error stopped after a failed deletion (--fail-fast): deleted %d of %d files",
+			meta.deleted, len(meta.fMeta))
+	}
+
+	if len(meta.failed) > 0 {
+		return fmt.Errorf("error deleting files: %d of %d files could not be deleted", len(meta.failed), len(meta.fMeta))
+	}
+
+	if planDiffs > 0 {
+		return fmt.Errorf("error %d files differ from the plan in %s", planDiffs, ctx.String("compare-plan"))
 	}
 
-	fmt.Print("\n")
 	return nil
 }
 
-func (m metadata) reportFileMetadata() error {
-	if m.total == 0 {
-		return nil
+// reportPaths lists paths under a header starting with their number, if
+// there are any.
+func reportPaths(out io.Writer, header string, paths []string, opts listOptions) {
+	if len(paths) == 0 {
+		return
 	}
 
-	return m.fMeta.report(m.total)
+	sort.Strings(paths)
+	fmt.Fprintf(out, "%d %s:\n", len(paths), header)
+	for _, path := range paths {
+		fmt.Fprintf(out, "  %s\n", opts.display(path))
+	}
+	fmt.Fprint(out, "\n")
 }
 
-func (m metadata) reportDirMetadata() error {
-	return m.dMeta.report()
+func (d dirMap) report(out io.Writer, opts listOptions) error {
+	dirs := d.changed(opts.dirSortKey, opts.reverse)
+
+	var small []string
+	if opts.mergeDirsBelow > 0 {
+		var kept []string
+		for _, k := range dirs {
+			if d[k].filesDeleted < opts.mergeDirsBelow {
+				small = append(small, k)
+			} else {
+				kept = append(kept, k)
+			}
+		}
+		dirs = kept
+	}
+
+	return d.reportDirs(out, dirs, small, opts)
 }
 
-func (f fileMap) report(total int64) error {
-	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
-	fmt.Fprint(w, "FILE\tSIZE\n")
-	fmt.Fprint(w, "----\t----\n")
-	for k, v := range f {
-		fmt.Fprintf(w, "%s\t%s\n", k, humanize.Bytes(uint64(v)))
+// reportDirs prints a row for each of dirs followed, when merged is not
+// empty, by a single row adding up merged.
+func (d dirMap) reportDirs(out io.Writer, dirs, merged []string, opts listOptions) error {
+	row := func(v dirMeta) [3]string {
+		return [3]string{
+			humanize.Bytes(uint64(v.size)),
+			humanize.Bytes(uint64(v.size - v.bytesDeleted)),
+			humanize.Bytes(uint64(v.bytesDeleted)),
+		}
+	}
+
+	rows := make([][3]string, len(dirs))
+	for i, k := range dirs {
+		rows[i] = row(d[k])
+	}
+	var other string
+	if len(merged) > 0 {
+		var sum dirMeta
+		for _, k := range merged {
+			sum.size += d[k].size
+			sum.bytesDeleted += d[k].bytesDeleted
+		}
+		rows = append(rows, row(sum))
+		other = fmt.Sprintf("(%s other directories)", humanize.Comma(int64(len(merged))))
 	}
 
-	fmt.Fprint(w, "----\t----\n")
-	fmt.Fprintf(w, "TOTAL\t%s\n\n", humanize.Bytes(uint64(total)))
+	widths := [3]int{len("OLDSIZE"), len("NEWSIZE"), len("BYTES SAVED")}
+	for _, r := range rows {
+		for j, cell := range r {
+			widths[j] = max(widths[j], len(cell))
+		}
+	}
 
+	w := tabwriter.NewWriter(out, 12, 1, 3, ' ', 0)
+	fmt.Fprintf(w, "DIRECTORY\t%s\t%s\t%s\n",
+		padLeft("OLDSIZE", widths[0]),
+		padLeft("NEWSIZE", widths[1]),
+		padLeft("BYTES SAVED", widths[2]),
+	)
+	fmt.Fprintf(w, "---------\t%s\t%s\t%s\n",
+		padLeft("-------", widths[0]),
+		padLeft("-------", widths[1]),
+		padLeft("-----------", widths[2]),
+	)
+	rest := 3*3 + widths[0] + widths[1] + widths[2]
+	for i, r := range rows {
+		name := other
+		if i < len(dirs) {
+			name = opts.fitPath(opts.display(dirs[i]), rest)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			name,
+			padLeft(r[0], widths[0]),
+			padLeft(r[1], widths[1]),
+			padLeft(r[2], widths[2]),
+		)
+	}
 	if err := w.Flush(); err != nil {
-		log.Fatal(err)
+		return err
 	}
 
+	fmt.Fprint(out, "\n")
 	return nil
 }
 
-func deleteFilesByExtension(meta metadata) (metadata, error) {
-	for path, size := range meta.fMeta {
+// reportFailures lists the files that could not be deleted and why.
+func (m metadata) reportFailures(out io.Writer, opts listOptions) error {
+	paths := make([]string, 0, len(m.failed))
+	for path := range m.failed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	w := tabwriter.NewWriter(out, 12, 1, 3, ' ', 0)
+	fmt.Fprintf(w, "FAILED\tERROR\n")
+	fmt.Fprintf(w, "------\t-----\n")
+	for _, path := range paths {
+		fmt.Fprintf(w, "%s\t%v\n", opts.display(path), m.failed[path])
+	}
+	fmt.Fprint(w, "\n")
+
+	return w.Flush()
+}
+
+func (m metadata) reportFileMetadata(out io.Writer, opts listOptions) error {
+	return m.fMeta.report(out, m.total, opts)
+}
+
+func (m metadata) reportDirMetadata(out io.Writer, opts listOptions) error {
+	return m.dMeta.report(out, opts)
+}
+
+// projectedDirs returns the directories containing matched files with
+// bytesDeleted and filesDeleted filled in as if every match had been deleted.
+func (m metadata) projectedDirs() dirMap {
+	d := make(dirMap)
+	for path, f := range m.fMeta {
 		dir := filepath.Dir(path)
-		sz, ok := meta.dMeta[dir]
-		if ok {
-			err := os.Remove(path)
-			if err != nil {
-				return metadata{}, err
+		v, ok := d[dir]
+		if !ok {
+			v = m.dMeta[dir]
+		}
+		v.bytesDeleted += f.size
+		v.filesDeleted++
+		d[dir] = v
+	}
+	return d
+}
+
+func (f fileMap) report(out io.Writer, total int64, opts listOptions) error {
+	var (
+		shown        []string
+		hidden, more int
+	)
+	for _, k := range f.sorted(opts.sortKey, opts.reverse) {
+		if f[k].size < opts.hideBelow {
+			hidden++
+			continue
+		}
+		if opts.preview > 0 && len(shown) == opts.preview {
+			more++
+			continue
+		}
+		shown = append(shown, k)
+	}
+
+	totalSize := humanize.Bytes(uint64(total))
+	sizes := make([]string, len(shown))
+	width := len("SIZE")
+	if !opts.noTotal {
+		width = max(width, len(totalSize))
+	}
+	for i, k := range shown {
+		sizes[i] = humanize.Bytes(uint64(f[k].size))
+		width = max(width, len(sizes[i]))
+	}
+
+	var (
+		totalDisk string
+		disks     []string
+		diskWidth int
+	)
+	if opts.showDisk {
+		var sum int64
+		for _, v := range f {
+			sum += v.disk
+		}
+		totalDisk = humanize.Bytes(uint64(sum))
+		disks = make([]string, len(shown))
+		diskWidth = len("ON DISK")
+		if !opts.noTotal {
+			diskWidth = max(diskWidth, len(totalDisk))
+		}
+		for i, k := range shown {
+			disks[i] = humanize.Bytes(uint64(f[k].disk))
+			diskWidth = max(diskWidth, len(disks[i]))
+		}
+	}
+
+	header := "FILE\t" + padLeft("SIZE", width)
+	rule := "----\t" + padLeft("----", width)
+	if opts.showDisk {
+		header, rule = header+"\t"+padLeft("ON DISK", diskWidth), rule+"\t"+padLeft("-------", diskWidth)
+	}
+	if opts.showAtime {
+		header, rule = header+"\tACCESSED", rule+"\t--------"
+	}
+
+	w := tabwriter.NewWriter(out, 12, 1, 3, ' ', 0)
+	fmt.Fprintf(w, "%s\n", header)
+	fmt.Fprintf(w, "%s\n", rule)
+	// The columns after the path, each preceded by tabwriter's padding.
+	rest := 3 + width
+	if opts.showDisk {
+		rest += 3 + diskWidth
+	}
+	if opts.showAtime {
+		rest += 3 + len("2006-01-02 15:04")
+	}
+	for i, k := range shown {
+		fmt.Fprintf(w, "%s\t%s", opts.fitPath(opts.display(k), rest), padLeft(sizes[i], width))
+		if opts.showDisk {
+			fmt.Fprintf(w, "\t%s", padLeft(disks[i], diskWidth))
+		}
+		if opts.showAtime {
+			fmt.Fprintf(w, "\t%s", formatTime(f[k].accessTime))
+		}
+		fmt.Fprint(w, "\n")
+	}
+
+	if more > 0 {
+		fmt.Fprintf(w, "... and %s more files\t\n", humanize.Comma(int64(more)))
+	}
+	if hidden > 0 {
+		fmt.Fprintf(w, "... and %s smaller files\t\n", humanize.Comma(int64(hidden)))
+	}
+
+	if !opts.noTotal {
+		fmt.Fprintf(w, "%s\n", rule)
+		label := "TOTAL"
+		if opts.totalLabel != "" {
+			label = opts.totalLabel
+		}
+		fmt.Fprintf(w, "%s\t%s", label, padLeft(totalSize, width))
+		if opts.showDisk {
+			fmt.Fprintf(w, "\t%s", padLeft(totalDisk, diskWidth))
+		}
+		fmt.Fprint(w, "\n")
+	}
+	fmt.Fprint(w, "\n")
+
+	return w.Flush()
+}
+
+// padLeft right-aligns s in a column of the given width so that sizes line
+// up on their units.
+func padLeft(s string, width int) string {
+	if len(s) >= width {
+		return s
+	}
+	return strings.Repeat(" ", width-len(s)) + s
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+// deleteFilesByExtension removes every matched file with opts.remove. Paths are
+// handed out in batches of opts.batchSize to opts.workers goroutines, which
+// keeps scheduling overhead low when deleting many small files. Files that
+// cannot be removed are logged and recorded in meta.failed rather than
+// aborting the run. Once ctx is done no further files are removed.
+func deleteFilesByExtension(ctx context.Context, meta metadata, opts deleteOptions) metadata {
+	d := newDeleter(ctx, opts)
+	for path, f := range meta.fMeta {
+		if !d.add(path, f) {
+			break
+		}
+	}
+	return d.wait(meta)
+}
+
+// deletion is a matched file handed to the deletion workers.
+type deletion struct {
+	path string
+	meta fileMeta
+}
+
+// deleterPartial is the accounting of a single worker. Each worker accounts
+// for its own deletions, which are merged once all of them are done, so
+// workers never contend for or share a map.
+type deleterPartial struct {
+	dirs      dirMap
+	deleted   int
+	failed    map[string]error
+	changed   []string
+	conflicts []string
+	tooNew    []string
+}
+
+// deleter removes the files passed to add in batches on opts.workers
+// goroutines until wait is called.
+type deleter struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	opts     deleteOptions
+	batches  chan []deletion
+	batch    []deletion
+	partials []deleterPartial
+	wg       sync.WaitGroup
+}
+
+func newDeleter(ctx context.Context, opts deleteOptions) *deleter {
+	d := &deleter{
+		opts:     opts,
+		batches:  make(chan []deletion),
+		batch:    make([]deletion, 0, opts.batchSize),
+		partials: make([]deleterPartial, opts.workers),
+	}
+	d.ctx, d.cancel = context.WithCancel(ctx)
+
+	for i := range d.partials {
+		p := &d.partials[i]
+		p.dirs = make(dirMap)
+		p.failed = make(map[string]error)
+
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for batch := range d.batches {
+				for _, del := range batch {
+					if d.ctx.Err() != nil {
+						break
+					}
+					d.delete(p, del)
+				}
 			}
-			sz.bytesDeleted += size
+		}()
+	}
+
+	return d
+}
+
+func (d *deleter) delete(p *deleterPartial, del deletion) {
+	opts, path := d.opts, del.path
+	if opts.limiter.wait(d.ctx, del.meta.size) != nil {
+		return
+	}
+
+	if !opts.startedAt.IsZero() {
+		if info, err := os.Lstat(longPath(path)); err == nil && info.ModTime().After(opts.startedAt) {
+			slog.Warn("file modified after delly started; not deleting it", "path", path)
+			p.tooNew = append(p.tooNew, path)
+			return
+		}
+	}
+
+	if opts.revalidate && changedSince(path, del.meta) {
+		slog.Warn("file changed since it was matched; not deleting it", "path", path)
+		p.changed = append(p.changed, path)
+		return
+	}
+
+	var (
+		sum string
+		err error
+	)
+	if opts.manifest != nil {
+		sum, err = hashFile(path)
+		if errors.Is(err, errNotRegular) {
+			sum, err = "-", nil
+		}
+	}
+	if err == nil {
+		err = removeWithRetry(d.ctx, opts.remove, path, opts.retries)
+	}
+	if err == nil && opts.manifest != nil {
+		if merr := opts.manifest.record(path, sum, del.meta.size); merr != nil {
+			slog.Error("could not write manifest entry", "path", path, "err", merr)
+		}
+	}
+
+	if errors.Is(err, errConflictSkipped) {
+		slog.Warn("destination already exists; leaving the file in place", "path", path)
+		p.conflicts = append(p.conflicts, path)
+		return
+	}
+
+	if err != nil {
+		slog.Error("could not delete file", "path", path, "err", err)
+		p.failed[path] = err
+		if opts.failFast && !errors.Is(err, fs.ErrNotExist) {
+			d.cancel()
+		}
+		return
+	}
+
+	slog.Debug("deleted file", "path", path)
+	dir := filepath.Dir(path)
+	sz := p.dirs[dir]
+	sz.bytesDeleted += del.meta.size
+	sz.filesDeleted++
+	p.dirs[dir] = sz
+	p.deleted++
+	opts.progress.fileDeleted(del.meta.size)
+}
+
+// add queues path for deletion. It reports false once the deleter has been
+// stopped by ctx or --fail-fast and nothing more will be deleted.
+func (d *deleter) add(path string, f fileMeta) bool {
+	d.batch = append(d.batch, deletion{path: path, meta: f})
+	if len(d.batch) < d.opts.batchSize {
+		return d.ctx.Err() == nil
+	}
+
+	batch := d.batch
+	d.batch = make([]deletion, 0, d.opts.batchSize)
+	return d.send(batch)
+}
+
+func (d *deleter) send(batch []deletion) bool {
+	select {
+	case d.batches <- batch:
+		return true
+	case <-d.ctx.Done():
+		return false
+	}
+}
+
+// wait hands out the last batch, waits for the workers to finish and merges
+// their accounting into meta.
+func (d *deleter) wait(meta metadata) metadata {
+	defer d.cancel()
+
+	if len(d.batch) > 0 {
+		d.send(d.batch)
+		d.batch = nil
+	}
+	close(d.batches)
+	d.wg.Wait()
+
+	meta.failed = make(map[string]error)
+	for _, p := range d.partials {
+		for dir, pd := range p.dirs {
+			sz := meta.dMeta[dir]
+			sz.bytesDeleted += pd.bytesDeleted
+			sz.filesDeleted += pd.filesDeleted
 			meta.dMeta[dir] = sz
 		}
+		for path, err := range p.failed {
+			meta.failed[path] = err
+		}
+		meta.deleted += p.deleted
+		meta.changed = append(meta.changed, p.changed...)
+		meta.conflicts = append(meta.conflicts, p.conflicts...)
+		meta.tooNew = append(meta.tooNew, p.tooNew...)
 	}
 
-	return meta, nil
+	return meta
+}
+
+// changedSince reports whether path no longer has the size and modification
+// time it had when it was matched. A file that is gone counts as unchanged so
+// that deleting it fails as it would have without --revalidate.
+func changedSince(path string, f fileMeta) bool {
+	info, err := os.Lstat(longPath(path))
+	if err != nil {
+		return false
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		// Matched dangling links are recorded with a size of 0.
+		return !info.ModTime().Equal(f.modTime)
+	}
+	return info.Size() != f.size || !info.ModTime().Equal(f.modTime)
 }
 
-func collectDirMetadata(rootdir string, exts []string) (metadata, error) {
+// collectDirMetadata walks rootdir recording the size of every directory and
+// the files matching opts.exts, or not matching them when opts.invert is set.
+// If opts.onMatch is not nil it is called for each matched file as soon as it
+// is found. The walk stops with ctx's error once ctx is done.
+func collectDirMetadata(ctx context.Context, rootdir string, opts walkOptions) (metadata, error) {
 	dmap := make(dirMap)
 	fmap := make(fileMap)
+	extDirs := make(map[string]extDir)
+	protected := make(map[string]bool)
+	dirExts := make(map[string][]string)
 	var total int64
+	var streamed int
+
+	var rootDev uint64
+	if opts.sameFS {
+		info, err := os.Stat(rootdir)
+		if err != nil {
+			return metadata{}, err
+		}
+
+		dev, ok := deviceID(info)
+		if !ok {
+			slog.Warn("--same-fs is not supported on this platform; ignoring")
+			opts.sameFS = false
+		}
+		rootDev = dev
+	}
+
+	err := filepath.WalkDir(rootdir, func(path string, d fs.DirEntry, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err != nil {
+			if d == nil {
+				return err
+			}
+			// The directory itself was already handled; only its
+			// contents could not be listed.
+			slog.Warn("skipping directory that could not be read", "path", path, "err", err)
+			return nil
+		}
+
+		info, err := entryInfo(d, opts.statTimeout)
+		if err != nil {
+			slog.Warn("skipping file that could not be examined", "path", path, "err", err)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 
-	err := filepath.Walk(rootdir, func(path string, info fs.FileInfo, err error) error {
 		if info.IsDir() {
+			if opts.sameFS && path != rootdir {
+				if dev, _ := deviceID(info); dev != rootDev {
+					slog.Debug("skipping directory on another filesystem", "path", path)
+					return filepath.SkipDir
+				}
+			}
+
+			if opts.keepMarker != "" {
+				if _, err := os.Lstat(filepath.Join(path, opts.keepMarker)); err == nil {
+					if opts.keepSubtree {
+						slog.Debug("skipping directory with keep marker", "path", path)
+						return filepath.SkipDir
+					}
+					protected[path] = true
+				}
+			}
+
+			if opts.extDirs && path != rootdir && !protected[path] && !protected[filepath.Dir(path)] && !opts.protected[path] {
+				exts, ok := dirExts[filepath.Dir(path)]
+				if !ok {
+					exts = opts.exts
+				}
+				if ok, _ := matchExt(info.Name(), exts, opts.extCaseFold); ok {
+					o := opts
+					o.exts = exts
+					size, files, refuse, err := subtreeSize(path, info, o)
+					if err != nil {
+						return err
+					}
+					if refuse == "" {
+						slog.Debug("matched directory", "path", path)
+						extDirs[path] = extDir{size: size, files: files}
+						if sz, ok := dmap[filepath.Dir(path)]; ok {
+							sz.size += size
+							dmap[filepath.Dir(path)] = sz
+						}
+						return filepath.SkipDir
+					}
+					slog.Warn("not matching directory as a whole; looking at its files one by one", "path", path, "reason", refuse)
+				}
+			}
+
+			if opts.rcFile != "" {
+				inherited, ok := dirExts[filepath.Dir(path)]
+				if !ok || path == rootdir {
+					inherited = opts.exts
+				}
+
+				exts, err := applyRC(filepath.Join(path, opts.rcFile), inherited)
+				if err != nil {
+					return err
+				}
+				dirExts[path] = exts
+			}
+
 			var d dirMeta
 			dmap[path] = d
 		}
 
 		if !info.IsDir() {
-			if matchExt(info.Name(), exts) {
-				size := info.Size()
-				fmap[path] = size
-				total += size
+			o := opts
+			if exts, ok := dirExts[filepath.Dir(path)]; ok {
+				o.exts = exts
+			}
+
+			reason := o.match(path, info)
+			if reason == matched && protected[filepath.Dir(path)] {
+				reason = skipKeepMarker
+			}
+			opts.progress.fileScanned(reason == matched)
+
+			if reason != matched {
+				slog.Debug("skipping file", "path", path, "reason", reason.String())
+				if opts.onSkip != nil {
+					opts.onSkip(path, reason)
+				}
+			} else {
+				slog.Debug("matched file", "path", path)
+				f := newFileMeta(info)
+				if o.brokenSymlinks && isBrokenSymlink(path, info) {
+					// A dangling link frees no meaningful space.
+					f.size, f.disk = 0, 0
+				}
+				if opts.noKeep {
+					streamed++
+				} else {
+					fmap[path] = f
+				}
+				if !opts.noTotal {
+					total += f.size
+				}
+				if opts.onMatch != nil {
+					opts.onMatch(path, f)
+				}
 			}
 
 			dir := filepath.Dir(path)
@@ -194,46 +2245,123 @@ func collectDirMetadata(rootdir string, exts []string) (metadata, error) {
 
 		return nil
 	})
-	if err != nil {
-		return metadata{}, err
-	}
 
+	// What was gathered before an error is returned along with it, since
+	// with --stream-delete those matches may already be deleted.
 	return metadata{
-		dMeta: dmap,
-		fMeta: fmap,
-		total: total,
-	}, nil
+		dMeta:    dmap,
+		fMeta:    fmap,
+		total:    total,
+		noTotal:  opts.noTotal,
+		streamed: streamed,
+		extDirs:  extDirs,
+	}, err
+}
+
+func fileExt(file string) string {
+	return strings.TrimLeft(filepath.Ext(file), ".")
 }
 
-func matchExt(file string, ext []string) bool {
+// matchExt reports whether the file name matches one of ext and none of
+// its negations, and separately whether a negation matches it. A negation
+// "!tok" excludes files named tok or ending in ".tok", so "!log" excludes an
+// extension and "!important.log" a file name. Negations protect a file
+// whatever else is given, including --invert, so callers must check negated
+// before inverting matched. fold compares them regardless of case.
+func matchExt(file string, ext []string, fold bool) (matched, negated bool) {
+	if fold {
+		file = strings.ToLower(file)
+	}
+
 	for _, e := range ext {
-		if strings.TrimLeft(filepath.Ext(file), ".") == e {
-			return true
+		if fold {
+			e = strings.ToLower(e)
+		}
+		if neg, ok := strings.CutPrefix(e, "!"); ok {
+			if file == neg || strings.HasSuffix(file, "."+neg) {
+				return false, true
+			}
+		} else if fileExt(file) == e {
+			matched = true
+		}
+	}
+	return matched, false
+}
+
+// commandsFirst drops the subcommands unless one of them is the first
+// argument, so that a directory named like a subcommand is still cleaned
+// when it follows the options: delly -e log report cleans ./report. The
+// subcommands are kept for --help, which lists them.
+func commandsFirst(app *cli.App, args []string) {
+	if len(args) > 1 && app.Command(args[1]) != nil {
+		return
+	}
+	for _, a := range args[1:] {
+		if a == "-h" || a == "--help" {
+			return
 		}
 	}
-	return false
+	app.Commands = nil
 }
 
-func askForConfirmation(s string) bool {
-	reader := bufio.NewReader(os.Stdin)
+// confirmSummary describes the effect of the deletion on free space, falling
+// back to just the number of bytes when free space cannot be queried or the
+// files are only being moved.
+func confirmSummary(total int64, root string, moving bool) string {
+	size := humanize.Bytes(uint64(total))
+	if moving {
+		return fmt.Sprintf("Moving %s; no space is freed until the trash or quarantine directory is emptied", size)
+	}
+
+	free, err := freeSpace(root)
+	if err != nil {
+		return fmt.Sprintf("Freeing %s", size)
+	}
+	return fmt.Sprintf("Freeing %s; %s → %s free", size, humanize.Bytes(free), humanize.Bytes(free+uint64(total)))
+}
 
+func askForConfirmation(reader *bufio.Reader, out io.Writer, s string) (bool, error) {
 	for {
-		fmt.Printf("%s [y/n]: ", s)
+		fmt.Fprintf(out, "%s [y/n]: ", s)
 
 		response, err := reader.ReadString('\n')
 		if err != nil {
-			log.Fatal(err)
+			return false, fmt.Errorf("error reading confirmation: %w", err)
 		}
 
 		response = strings.ToLower(strings.TrimSpace(response))
 
-		fmt.Print("\n")
+		fmt.Fprint(out, "\n")
 
 		switch response {
 		case "y", "yes":
-			return true
+			return true, nil
 		case "n", "no":
-			return false
+			return false, nil
 		}
 	}
 }
+
+// deletePhrase is what askForPhrase has the user type to delete n files.
+func deletePhrase(n int) string {
+	if n == 1 {
+		return "DELETE 1 FILE"
+	}
+	return fmt.Sprintf("DELETE %d FILES", n)
+}
+
+// askForPhrase is askForConfirmation for dangerous deletions: the user has
+// to type phrase exactly, which is much harder to do by accident than y.
+// Anything else is taken as no.
+func askForPhrase(reader *bufio.Reader, out io.Writer, s, phrase string) (bool, error) {
+	fmt.Fprintf(out, "%s\ntype %q to confirm: ", s, phrase)
+
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf("error reading confirmation: %w", err)
+	}
+
+	fmt.Fprint(out, "\n")
+
+	return strings.TrimSpace(response) == phrase, nil
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+// runDelly runs delly with args, reading stdin from in, and returns what it
+// wrote to stdout.
+func runDelly(t *testing.T, in string, args ...string) (string, error) {
+	t.Helper()
+	var out strings.Builder
+	app := newApp()
+	app.Reader = strings.NewReader(in)
+	app.Writer = &out
+	app.ErrWriter = io.Discard
+	// Keep exit codes from exiting the test binary.
+	app.ExitErrHandler = func(*cli.Context, error) {}
+	args = append([]string{"delly"}, args...)
+	commandsFirst(app, args)
+	err := app.Run(args)
+	return out.String(), err
+}
+
+// writeFiles creates the files under root, each holding its contents.
+func writeFiles(t testing.TB, root string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSymlinkedRootScansTarget(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "releases", "v5")
+	writeFiles(t, target, map[string]string{
+		"app.log":      "log",
+		"logs/old.log": "old",
+		"app.conf":     "conf",
+	})
+	link := filepath.Join(dir, "current")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+
+	if _, err := runDelly(t, "y\n", "-e", "log", link); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"app.log", "logs/old.log"} {
+		if _, err := os.Lstat(filepath.Join(target, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			t.Errorf("%s was not deleted through the symlinked root: %v", name, err)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(target, "app.conf")); err != nil {
+		t.Errorf("non-matching file was deleted: %v", err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("the root symlink itself was touched: %v", err)
+	}
+}
+
+func TestZeroByteMatchesAreDeleted(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a.tmp":     "",
+		"sub/b.tmp": "",
+		"c.txt":     "",
+	})
+
+	out, err := runDelly(t, "y\n", "-e", "tmp", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "nothing to delete") {
+		t.Fatalf("empty matches left nothing to delete:\n%s", out)
+	}
+	for _, name := range []string{"a.tmp", "b.tmp", filepath.Join(root, "sub")} {
+		if !strings.Contains(out, name) {
+			t.Errorf("%s is not reported:\n%s", name, out)
+		}
+	}
+
+	for _, name := range []string{"a.tmp", "sub/b.tmp"} {
+		if _, err := os.Lstat(filepath.Join(root, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			t.Errorf("empty match %s was not deleted: %v", name, err)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(root, "c.txt")); err != nil {
+		t.Errorf("non-matching file was deleted: %v", err)
+	}
+}
+
+// writeTree creates dirs directories under root holding files .tmp files
+// and one .keep file each, file i of a directory being i bytes long.
+func writeTree(t testing.TB, root string, dirs, files int) {
+	t.Helper()
+	for d := 0; d < dirs; d++ {
+		dir := filepath.Join(root, fmt.Sprintf("d%02d", d/10), fmt.Sprintf("d%02d", d))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < files; i++ {
+			path := filepath.Join(dir, fmt.Sprintf("f%03d.tmp", i))
+			if err := os.WriteFile(path, make([]byte, i), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.WriteFile(filepath.Join(dir, "f.keep"), []byte("keep"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestDeleteAccountingDeterministic deletes the same tree over and over with
+// many workers and checks the per-directory accounting never varies. Run it
+// with -race to also catch unsynchronized access to the accounting.
+func TestDeleteAccountingDeterministic(t *testing.T) {
+	const (
+		runs  = 10
+		dirs  = 40
+		files = 50
+	)
+
+	var first dirMap
+	for run := 0; run < runs; run++ {
+		root := t.TempDir()
+		writeTree(t, root, dirs, files)
+
+		meta, err := collectDirMetadata(context.Background(), root, walkOptions{exts: []string{"tmp"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(meta.fMeta), dirs*files; got != want {
+			t.Fatalf("run %d: matched %d files, want %d", run, got, want)
+		}
+
+		meta = deleteFilesByExtension(context.Background(), meta, deleteOptions{
+			remove:    os.Remove,
+			workers:   8,
+			batchSize: 7,
+		})
+		if len(meta.failed) != 0 {
+			t.Fatalf("run %d: failed to delete %v", run, meta.failed)
+		}
+		if meta.deleted != dirs*files {
+			t.Fatalf("run %d: deleted %d files, want %d", run, meta.deleted, dirs*files)
+		}
+
+		// The accounting is keyed by path, which differs between runs.
+		got := make(dirMap, len(meta.dMeta))
+		for dir, d := range meta.dMeta {
+			rel, err := filepath.Rel(root, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got[rel] = d
+		}
+
+		if first == nil {
+			first = got
+			var leaves int
+			for rel, d := range got {
+				if filepath.Dir(rel) == "." {
+					continue
+				}
+				leaves++
+				if want := int64(files * (files - 1) / 2); d.filesDeleted != files || d.bytesDeleted != want {
+					t.Errorf("%s: deleted %d files and %d bytes, want %d and %d", rel, d.filesDeleted, d.bytesDeleted, files, want)
+				}
+			}
+			if leaves != dirs {
+				t.Errorf("accounted for %d directories holding matches, want %d", leaves, dirs)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, first) {
+			t.Fatalf("run %d: directory accounting differs from the first run:\n got %v\nwant %v", run, got, first)
+		}
+	}
+}
+
+// TestRelativeAndAbsoluteRootSavings deletes the same tree once given as "."
+// and once as an absolute path and checks both report the same savings.
+func TestRelativeAndAbsoluteRootSavings(t *testing.T) {
+	files := map[string]string{
+		"x.tmp":     "hello",
+		"a/y.tmp":   "hello, world",
+		"a/k.txt":   "keep",
+		"a/b/z.tmp": "hello, world, again",
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	savings := func(root, arg string) string {
+		t.Helper()
+		writeFiles(t, root, files)
+		if err := os.Chdir(root); err != nil {
+			t.Fatal(err)
+		}
+		out, err := runDelly(t, "y\n", "-e", "tmp", arg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		i := strings.Index(out, "DIRECTORY")
+		if i < 0 {
+			t.Fatalf("no directory savings reported:\n%s", out)
+		}
+		return strings.ReplaceAll(out[i:], root, "<root>")
+	}
+
+	abs, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromAbs := savings(abs, abs)
+	fromRel := savings(rel, ".")
+	if fromAbs != fromRel {
+		t.Errorf("savings differ between an absolute and a relative root:\nabsolute:\n%s\nrelative:\n%s", fromAbs, fromRel)
+	}
+	for _, dir := range []string{"<root> ", filepath.Join("<root>", "a") + " ", filepath.Join("<root>", "a", "b") + " "} {
+		if !strings.Contains(fromRel, dir) {
+			t.Errorf("%s is missing from the savings:\n%s", dir, fromRel)
+		}
+	}
+}
+
+// BenchmarkDelete compares deleting 50,000 small files with one goroutine
+// per file against the batched worker pool delly uses.
+func BenchmarkDelete(b *testing.B) {
+	const (
+		dirs  = 100
+		files = 500
+	)
+
+	setup := func(b *testing.B) metadata {
+		b.Helper()
+		b.StopTimer()
+		defer b.StartTimer()
+		root := b.TempDir()
+		writeTree(b, root, dirs, files)
+		meta, err := collectDirMetadata(context.Background(), root, walkOptions{exts: []string{"tmp"}})
+		if err != nil {
+			b.Fatal(err)
+		}
+		return meta
+	}
+
+	b.Run("goroutine-per-file", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			meta := setup(b)
+			var (
+				mu sync.Mutex
+				wg sync.WaitGroup
+			)
+			for path, f := range meta.fMeta {
+				wg.Add(1)
+				go func(path string, f fileMeta) {
+					defer wg.Done()
+					if err := os.Remove(path); err != nil {
+						b.Error(err)
+						return
+					}
+					mu.Lock()
+					d := meta.dMeta[filepath.Dir(path)]
+					d.bytesDeleted += f.size
+					d.filesDeleted++
+					meta.dMeta[filepath.Dir(path)] = d
+					mu.Unlock()
+				}(path, f)
+			}
+			wg.Wait()
+		}
+	})
+
+	b.Run("batched", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			meta := setup(b)
+			meta = deleteFilesByExtension(context.Background(), meta, deleteOptions{
+				remove:    os.Remove,
+				workers:   runtime.NumCPU(),
+				batchSize: 64,
+			})
+			if len(meta.failed) != 0 {
+				b.Fatalf("failed to delete %d files", len(meta.failed))
+			}
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// manifest records the SHA-256 hash and size of every deleted file as
+// tab separated "path, hash, size" lines following a "#" header line that
+// carries the schema version. Paths that could not be read back as they
+// are, see manifestPath, are written Go-quoted. Files other than regular
+// files and symlinks have no contents to hash and get "-" instead. It is
+// safe for concurrent use.
+type manifest struct {
+	mu sync.Mutex
+	f  *os.File
+	w  *bufio.Writer
+}
+
+func createManifest(path string) (*manifest, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &manifest{f: f, w: bufio.NewWriter(f)}
+	fmt.Fprintf(m.w, "# delly manifest schema_version=%d\n", schemaVersion)
+
+	return m, nil
+}
+
+func (m *manifest) record(path, sum string, size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintf(m.w, "%s\t%s\t%d\n", manifestPath(path), sum, size)
+	return err
+}
+
+// manifestPath returns path quoted with strconv.Quote when it holds a tab or
+// line break, which would split its manifest line, is not valid UTF-8, or
+// starts with a double quote, which would make it look quoted. Any other
+// path is written as it is.
+func manifestPath(path string) string {
+	if !utf8.ValidString(path) || strings.ContainsAny(path, "\t\n\r") || strings.HasPrefix(path, `"`) {
+		return strconv.Quote(path)
+	}
+	return path
+}
+
+func (m *manifest) Close() error {
+	if err := m.w.Flush(); err != nil {
+		m.f.Close()
+		return err
+	}
+	return m.f.Close()
+}
+
+// errNotRegular is returned by hashFile for a file without contents to hash,
+// such as a FIFO, whose reading could block forever, or a device.
+var errNotRegular = errors.New("not a regular file")
+
+// hashFile returns the SHA-256 hash of the contents of path or, for a
+// symlink, of the path it points to.
+func hashFile(path string) (string, error) {
+	info, err := os.Lstat(longPath(path))
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(longPath(path))
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256([]byte(target))
+		return hex.EncodeToString(sum[:]), nil
+	case !info.Mode().IsRegular():
+		return "", fmt.Errorf("%s: %w", path, errNotRegular)
+	}
+
+	f, err := os.Open(longPath(path))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
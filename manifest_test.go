@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestManifestPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/data/app.log", "/data/app.log"},
+		{"/data/café.log", "/data/café.log"},
+		{"/data/with space.log", "/data/with space.log"},
+		{"/data/tab\there.log", `"/data/tab\there.log"`},
+		{"/data/line\nbreak.log", `"/data/line\nbreak.log"`},
+		{"/data/bad\xff.log", `"/data/bad\xff.log"`},
+		{`"quoted".log`, `"\"quoted\".log"`},
+	}
+	for _, tt := range tests {
+		got := manifestPath(tt.path)
+		if got != tt.want {
+			t.Errorf("manifestPath(%q) = %s, want %s", tt.path, got, tt.want)
+		}
+		if got != tt.path {
+			if back, err := strconv.Unquote(got); err != nil || back != tt.path {
+				t.Errorf("manifestPath(%q) = %s does not unquote back: %q, %v", tt.path, got, back, err)
+			}
+		}
+	}
+}
+
+func TestManifestLinesWithTabsInNames(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "a\tb.log")
+	if err := os.WriteFile(path, []byte("abc"), 0o644); err != nil {
+		t.Skipf("cannot create a file with a tab in its name: %v", err)
+	}
+	manifest := filepath.Join(t.TempDir(), "manifest.tsv")
+
+	if _, err := runDelly(t, "y\n", "-e", "log", "--manifest", manifest, root); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("manifest has %d lines, want a header and one entry:\n%s", len(lines), data)
+	}
+	fields := strings.Split(lines[1], "\t")
+	if len(fields) != 3 {
+		t.Fatalf("manifest entry has %d fields, want 3: %q", len(fields), lines[1])
+	}
+	if got, err := strconv.Unquote(fields[0]); err != nil || got != path {
+		t.Errorf("manifest path %s reads back as %q (%v), want %q", fields[0], got, err, path)
+	}
+	if fields[2] != "3" {
+		t.Errorf("manifest size %s, want 3", fields[2])
+	}
+}
@@ -0,0 +1,74 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestHashFileSkipsFIFOs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipe.log")
+	if err := syscall.Mkfifo(path, 0o644); err != nil {
+		t.Skipf("cannot create a FIFO: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := hashFile(path)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, errNotRegular) {
+			t.Errorf("hashFile of a FIFO returned %v, want errNotRegular", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("hashFile blocked on a FIFO")
+	}
+}
+
+func TestFlattenReportHashWithFIFO(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"a.log": "same", "b/a.log": "same"})
+	if err := syscall.Mkfifo(filepath.Join(root, "pipe.log"), 0o644); err != nil {
+		t.Skipf("cannot create a FIFO: %v", err)
+	}
+
+	out, err := runDelly(t, "", "-e", "log", "--dry-run", "--flatten-report", "hash", root)
+	var ec cli.ExitCoder
+	if err != nil && (!errors.As(err, &ec) || ec.ExitCode() != dryRunMatchesExitCode) {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "pipe.log") {
+		t.Errorf("FIFO missing from the flattened report:\n%s", out)
+	}
+}
+
+func TestManifestRecordsFIFOWithoutHash(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "pipe.log")
+	if err := syscall.Mkfifo(path, 0o644); err != nil {
+		t.Skipf("cannot create a FIFO: %v", err)
+	}
+	manifest := filepath.Join(t.TempDir(), "manifest.tsv")
+
+	if _, err := runDelly(t, "y\n", "-e", "log", "--manifest", manifest, root); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := path + "\t-\t0\n"; !strings.HasSuffix(string(data), want) {
+		t.Errorf("manifest does not end with %q:\n%s", want, data)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// skipReason explains why a file was not selected for deletion. The zero value
+// means the file matched.
+type skipReason int
+
+const (
+	matched skipReason = iota
+	skipExt
+	skipInvertedExt
+	skipOwner
+	skipKeepMarker
+	skipNotNewer
+	skipNotOlder
+	skipNewest
+	skipMode
+	skipNoNewerSibling
+	skipRecentlyAccessed
+	skipOpen
+	skipTargetReached
+	skipLimitReached
+	skipModifiedAfterStart
+	skipProtected
+	skipNegated
+)
+
+func (r skipReason) String() string {
+	switch r {
+	case matched:
+		return "matched"
+	case skipExt:
+		return "extension not given with --ext"
+	case skipInvertedExt:
+		return "extension given with --ext (--invert)"
+	case skipOwner:
+		return "owned by another user"
+	case skipKeepMarker:
+		return "directory contains a keep marker"
+	case skipNotNewer:
+		return "not modified after the --newer-than-file reference"
+	case skipNotOlder:
+		return "not modified before the --older-than-file reference"
+	case skipNewest:
+		return "one of the --keep-newest files"
+	case skipMode:
+		return "permissions do not match --mode"
+	case skipNoNewerSibling:
+		return "no newer --newer-sibling file"
+	case skipRecentlyAccessed:
+		return "accessed within the --unused-for window"
+	case skipOpen:
+		return "open in another process"
+	case skipTargetReached:
+		return "not needed to reach --target-free"
+	case skipLimitReached:
+		return "over the --limit for its extension"
+	case skipModifiedAfterStart:
+		return "modified after delly started"
+	case skipProtected:
+		return "listed in the --protect-file"
+	case skipNegated:
+		return "excluded with '!' in --ext"
+	default:
+		return "unknown"
+	}
+}
+
+func (o walkOptions) match(path string, info fs.FileInfo) skipReason {
+	if o.protected[path] {
+		return skipProtected
+	}
+
+	// A broken symlink is matched whatever its extension, but a name
+	// excluded with '!' is never matched.
+	broken := o.brokenSymlinks && isBrokenSymlink(path, info)
+	if !o.anyExt {
+		ok, negated := matchExt(info.Name(), o.exts, o.extCaseFold)
+		if negated {
+			return skipNegated
+		}
+		if ok == o.invert && !broken {
+			if o.invert {
+				return skipInvertedExt
+			}
+			return skipExt
+		}
+	}
+
+	if o.filterOwner {
+		if uid, ok := fileOwner(info); !ok || uid != o.uid {
+			return skipOwner
+		}
+	}
+
+	if o.mode != nil && !o.mode.match(info.Mode().Perm()) {
+		return skipMode
+	}
+
+	if !o.newerThan.IsZero() && !info.ModTime().After(o.newerThan) {
+		return skipNotNewer
+	}
+	if !o.olderThan.IsZero() && !info.ModTime().Before(o.olderThan) {
+		return skipNotOlder
+	}
+
+	if !o.startedAt.IsZero() && info.ModTime().After(o.startedAt) {
+		return skipModifiedAfterStart
+	}
+
+	if !o.unusedSince.IsZero() {
+		if atime, ok := accessTime(info); !ok || !atime.Before(o.unusedSince) {
+			return skipRecentlyAccessed
+		}
+	}
+
+	if o.openFiles != nil {
+		dev, _ := deviceID(info)
+		ino, _ := fileID(info)
+		if o.openFiles[[2]uint64{dev, ino}] {
+			slog.Warn("skipping file open in another process", "path", path)
+			return skipOpen
+		}
+	}
+
+	if o.newerSibling != "" && !hasNewerSibling(path, info, o.newerSibling) {
+		return skipNoNewerSibling
+	}
+
+	return matched
+}
+
+// isBrokenSymlink reports whether info, as returned by Lstat for path, is a
+// symlink whose target does not exist.
+func isBrokenSymlink(path string, info fs.FileInfo) bool {
+	if info.Mode()&fs.ModeSymlink == 0 {
+		return false
+	}
+	_, err := os.Stat(path)
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+// siblingPath returns the primary file that path is a copy of: path without
+// its own extension, with ext added unless it already ends in it. Both
+// report.csv.bak and report.bak pair with report.csv for ext "csv".
+func siblingPath(path, ext string) string {
+	stem := strings.TrimSuffix(path, filepath.Ext(path))
+	if fileExt(stem) == ext {
+		return stem
+	}
+	return stem + "." + ext
+}
+
+// hasNewerSibling reports whether the primary file of path exists and was
+// modified after it.
+func hasNewerSibling(path string, info fs.FileInfo, ext string) bool {
+	sibling, err := os.Stat(siblingPath(path, ext))
+	return err == nil && sibling.ModTime().After(info.ModTime())
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchExtNegations(t *testing.T) {
+	tests := []struct {
+		file    string
+		exts    []string
+		fold    bool
+		matched bool
+		negated bool
+	}{
+		{"app.log", []string{"log"}, false, true, false},
+		{"app.tmp", []string{"log"}, false, false, false},
+		{"important.log", []string{"log", "!important.log"}, false, false, true},
+		// Negations win regardless of where they appear in the list.
+		{"important.log", []string{"!important.log", "log"}, false, false, true},
+		{"app.important.log", []string{"log", "!important.log"}, false, false, true},
+		{"unimportant.log", []string{"log", "!important.log"}, false, true, false},
+		{"app.tar.gz", []string{"gz", "!tar.gz"}, false, false, true},
+		{"app.gz", []string{"gz", "!tar.gz"}, false, true, false},
+		{"IMPORTANT.LOG", []string{"log", "!important.log"}, true, false, true},
+		{"IMPORTANT.LOG", []string{"LOG", "!important.log"}, false, true, false},
+		// A negation alone excludes without matching anything else.
+		{"app.log", []string{"!important.log"}, false, false, false},
+	}
+	for _, tt := range tests {
+		matched, negated := matchExt(tt.file, tt.exts, tt.fold)
+		if matched != tt.matched || negated != tt.negated {
+			t.Errorf("matchExt(%q, %q, %v) = %v, %v; want %v, %v",
+				tt.file, tt.exts, tt.fold, matched, negated, tt.matched, tt.negated)
+		}
+	}
+}
+
+func TestMatchNegationsUnderInvert(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"app.log":       "",
+		"important.log": "",
+		"notes.txt":     "",
+		"keep.txt":      "",
+	})
+
+	tests := []struct {
+		exts   []string
+		invert bool
+		want   map[string]skipReason
+	}{
+		{
+			exts: []string{"log", "!important.log"},
+			want: map[string]skipReason{
+				"app.log":       matched,
+				"important.log": skipNegated,
+				"notes.txt":     skipExt,
+				"keep.txt":      skipExt,
+			},
+		},
+		{
+			exts:   []string{"log", "!important.log", "!keep.txt"},
+			invert: true,
+			want: map[string]skipReason{
+				"app.log":       skipInvertedExt,
+				"important.log": skipNegated,
+				"notes.txt":     matched,
+				"keep.txt":      skipNegated,
+			},
+		},
+	}
+	for _, tt := range tests {
+		opts := walkOptions{exts: tt.exts, invert: tt.invert}
+		for name, want := range tt.want {
+			path := filepath.Join(dir, name)
+			info, err := os.Lstat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := opts.match(path, info); got != want {
+				t.Errorf("exts %q, invert %v: %s is %q, want %q", tt.exts, tt.invert, name, got, want)
+			}
+		}
+	}
+}
+
+func TestBrokenSymlinksHonourNegations(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing")
+	for _, name := range []string{"important.log", "stale.lnk"} {
+		if err := os.Symlink(missing, filepath.Join(dir, name)); err != nil {
+			t.Skipf("cannot create symlinks: %v", err)
+		}
+	}
+
+	if _, err := runDelly(t, "y\n", "-e", "log,!important.log", "--broken-symlinks", dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Lstat(filepath.Join(dir, "important.log")); err != nil {
+		t.Errorf("broken symlink excluded with '!' was deleted: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "stale.lnk")); !os.IsNotExist(err) {
+		t.Errorf("broken symlink was not deleted: %v", err)
+	}
+}
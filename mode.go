@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+// modeFilter matches permission bits either exactly (an octal mode such as
+// 0644) or when any of bits is set (a symbolic mode such as +x or o+w).
+type modeFilter struct {
+	bits  fs.FileMode
+	exact bool
+}
+
+func (m modeFilter) match(perm fs.FileMode) bool {
+	if m.exact {
+		return perm == m.bits
+	}
+	return perm&m.bits != 0
+}
+
+// parseModeFilter parses the value of --mode. Symbolic modes take the form
+// [ugoa...]+[rwx...]; leaving out the classes means all of them.
+func parseModeFilter(s string) (*modeFilter, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	if n, err := strconv.ParseUint(s, 8, 32); err == nil {
+		if n > 0o777 {
+			return nil, fmt.Errorf("error invalid mode %q: octal modes must be between 0 and 0777", s)
+		}
+		return &modeFilter{bits: fs.FileMode(n), exact: true}, nil
+	}
+
+	who, what, ok := strings.Cut(s, "+")
+	if !ok || what == "" {
+		return nil, fmt.Errorf("error invalid mode %q: must be octal (e.g. 0777) or symbolic (e.g. +x, o+w)", s)
+	}
+
+	var classes fs.FileMode
+	for _, c := range who {
+		switch c {
+		case 'u':
+			classes |= 0o700
+		case 'g':
+			classes |= 0o070
+		case 'o':
+			classes |= 0o007
+		case 'a':
+			classes |= 0o777
+		default:
+			return nil, fmt.Errorf("error invalid mode %q: unknown class %q", s, c)
+		}
+	}
+	if classes == 0 {
+		classes = 0o777
+	}
+
+	var perms fs.FileMode
+	for _, c := range what {
+		switch c {
+		case 'r':
+			perms |= 0o444
+		case 'w':
+			perms |= 0o222
+		case 'x':
+			perms |= 0o111
+		default:
+			return nil, fmt.Errorf("error invalid mode %q: unknown permission %q", s, c)
+		}
+	}
+
+	return &modeFilter{bits: classes & perms}, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+// moveFile renames src to dst, falling back to copy and remove when the two
+// paths are on different devices.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+
+	return os.Remove(src)
+}
+
+// freeName returns path, or path with a ".N" suffix counting up from 2 if
+// something already exists there, matching how the XDG trash names
+// duplicates.
+func freeName(path string) string {
+	name := path
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(longPath(name)); errors.Is(err, os.ErrNotExist) {
+			return name
+		}
+		name = fmt.Sprintf("%s.%d", path, i)
+	}
+}
+
+// conflictPolicy says what a move does when its destination already exists.
+type conflictPolicy string
+
+const (
+	conflictRename    conflictPolicy = "rename"
+	conflictSkip      conflictPolicy = "skip"
+	conflictOverwrite conflictPolicy = "overwrite"
+)
+
+var conflictPolicies = []conflictPolicy{conflictRename, conflictSkip, conflictOverwrite}
+
+func parseConflictPolicy(s string) (conflictPolicy, error) {
+	for _, p := range conflictPolicies {
+		if conflictPolicy(s) == p {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("error invalid --on-conflict %q: must be one of %v", s, conflictPolicies)
+}
+
+// errConflictSkipped is returned for a file left in place by the skip policy.
+var errConflictSkipped = errors.New("destination already exists")
+
+// moveTo moves src to dst. If something already exists at dst, rename moves
+// src next to it with a ".N" suffix, skip leaves src where it is and returns
+// errConflictSkipped, and overwrite replaces it.
+func moveTo(src, dst string, policy conflictPolicy) error {
+	switch policy {
+	case conflictSkip:
+		if _, err := os.Lstat(longPath(dst)); err == nil {
+			return fmt.Errorf("%s: %w", dst, errConflictSkipped)
+		}
+	case conflictOverwrite:
+		// os.Rename replaces dst by itself, but copying across devices
+		// refuses to.
+		if err := os.Remove(longPath(dst)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	default:
+		dst = freeName(dst)
+	}
+
+	return moveFile(longPath(src), longPath(dst))
+}
+
+// copyFile copies src to dst, which must not exist. A symlink is copied as
+// a link to the same target rather than as the file it points to, so that
+// moving it does not turn it into a copy of that file.
+func copyFile(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err = in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyFileKeepsSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.log")
+	if err := os.WriteFile(target, []byte("contents"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.log")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+
+	dst := filepath.Join(dir, "copy.log")
+	if err := copyFile(link, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Lstat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("copy of a symlink is a %v, not a symlink", info.Mode())
+	}
+	if got, err := os.Readlink(dst); err != nil || got != target {
+		t.Errorf("copy points to %q (%v), want %q", got, err, target)
+	}
+}
+
+func TestCopyFileCopiesContents(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.log")
+	if err := os.WriteFile(src, []byte("contents"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(dir, "dst.log")
+	if err := copyFile(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(dst); err != nil || string(got) != "contents" {
+		t.Errorf("copy holds %q (%v), want %q", got, err, "contents")
+	}
+	if err := copyFile(src, dst); err == nil {
+		t.Error("copyFile overwrote an existing file")
+	}
+}
@@ -0,0 +1,18 @@
+//go:build linux
+
+package main
+
+import "syscall"
+
+// stNoAtime is ST_NOATIME from statvfs(3), reported in Statfs_t.Flags.
+const stNoAtime = 0x400
+
+// noAtime reports whether the filesystem holding path is mounted noatime,
+// so that access times are never updated.
+func noAtime(path string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return false
+	}
+	return st.Flags&stNoAtime != 0
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package main
+
+func noAtime(path string) bool {
+	return false
+}
@@ -0,0 +1,38 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const openFilesSupported = true
+
+// openFiles returns the device and inode of every file other processes
+// hold open, found by following the links in /proc/<pid>/fd. Processes whose
+// descriptors cannot be read, usually those of other users when not running
+// as root, are silently left out, so the result is best-effort.
+func openFiles() map[[2]uint64]bool {
+	open := make(map[[2]uint64]bool)
+	self := strconv.Itoa(os.Getpid())
+
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+		if filepath.Base(filepath.Dir(filepath.Dir(fd))) == self {
+			continue
+		}
+
+		info, err := os.Stat(fd)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		dev, _ := deviceID(info)
+		ino, _ := fileID(info)
+		open[[2]uint64{dev, ino}] = true
+	}
+
+	return open
+}
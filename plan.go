@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+)
+
+const planHeader = "# delly plan schema_version=%d root=%s"
+
+// savePlan writes every matched file to path, one per line after a header
+// naming root, so that a later run can be checked against it with
+// --compare-plan.
+func (m metadata) savePlan(path, root string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, planHeader+"\n", schemaVersion, root)
+	for _, p := range m.fMeta.sorted("path", false) {
+		fmt.Fprintln(w, p)
+	}
+
+	err = w.Flush()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// readPlan reads the files listed by savePlan for root.
+func readPlan(path, root string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("error reading plan %s: empty file", path)
+	}
+
+	head, saved, ok := strings.Cut(scanner.Text(), " root=")
+	var version int
+	if _, err := fmt.Sscanf(head, "# delly plan schema_version=%d", &version); !ok || err != nil {
+		return nil, fmt.Errorf("error reading plan %s: invalid header", path)
+	}
+	if version != schemaVersion {
+		return nil, fmt.Errorf("error reading plan %s: unsupported schema version %d", path, version)
+	}
+	if saved != root {
+		return nil, fmt.Errorf("error reading plan %s: it was saved for %s, not %s", path, saved, root)
+	}
+
+	plan := make(map[string]bool)
+	for scanner.Scan() {
+		if p := scanner.Text(); strings.TrimSpace(p) != "" {
+			plan[p] = true
+		}
+	}
+	return plan, scanner.Err()
+}
+
+// reportPlanDiff compares the files this run deleted, that is the matches
+// that no longer exist, with plan. It lists the planned files that are still
+// there or were not matched, and the deleted files that were not planned,
+// and returns how many were listed.
+func (m metadata) reportPlanDiff(out io.Writer, plan map[string]bool, opts listOptions) int {
+	gone := func(path string) bool {
+		_, err := os.Lstat(longPath(path))
+		return errors.Is(err, fs.ErrNotExist)
+	}
+
+	changed := make(map[string]bool)
+	for _, p := range m.changed {
+		changed[p] = true
+	}
+	conflicts := make(map[string]bool)
+	for _, p := range m.conflicts {
+		conflicts[p] = true
+	}
+	tooNew := make(map[string]bool)
+	for _, p := range m.tooNew {
+		tooNew[p] = true
+	}
+
+	var kept []string
+	reasons := make(map[string]string)
+	for path := range plan {
+		_, matched := m.fMeta[path]
+		switch {
+		case !matched && gone(path):
+			reasons[path] = "no longer exists"
+		case !matched:
+			reasons[path] = "not matched"
+		case gone(path):
+			continue
+		case m.failed[path] != nil:
+			reasons[path] = m.failed[path].Error()
+		case changed[path]:
+			reasons[path] = "changed since it was matched"
+		case conflicts[path]:
+			reasons[path] = "destination already exists"
+		case tooNew[path]:
+			reasons[path] = "modified after delly started"
+		default:
+			reasons[path] = "not deleted"
+		}
+		kept = append(kept, path)
+	}
+
+	var extra []string
+	for path := range m.fMeta {
+		if !plan[path] && gone(path) {
+			extra = append(extra, path)
+		}
+	}
+
+	if len(kept) > 0 {
+		sort.Strings(kept)
+		fmt.Fprintf(out, "%d planned files were not deleted:\n", len(kept))
+		for _, path := range kept {
+			fmt.Fprintf(out, "  %s: %s\n", opts.display(path), reasons[path])
+		}
+		fmt.Fprint(out, "\n")
+	}
+	reportPaths(out, "files were deleted but not planned", extra, opts)
+
+	if len(kept) == 0 && len(extra) == 0 {
+		fmt.Fprintf(out, "The deleted files match the plan.\n\n")
+	}
+
+	return len(kept) + len(extra)
+}
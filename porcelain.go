@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// schemaVersion is included in every machine-readable output. It is bumped
+// whenever a field is renamed, removed or changes meaning; adding fields is
+// not a breaking change and keeps the current version.
+const schemaVersion = 1
+
+// reportPorcelain prints a single line of space separated key=value pairs
+// that is stable across versions and safe to parse from scripts.
+func (m metadata) reportPorcelain(out io.Writer) {
+	fmt.Fprintf(out, "schema_version=%d files_matched=%d bytes_matched=%d files_deleted=%d bytes_freed=%d failures=%d\n",
+		schemaVersion,
+		m.matched(),
+		m.total,
+		m.deleted,
+		m.freed(),
+		len(m.failed),
+	)
+}
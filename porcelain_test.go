@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReportPorcelainFormat(t *testing.T) {
+	m := metadata{
+		dMeta: dirMap{
+			"/a": {bytesDeleted: 100000},
+			"/b": {bytesDeleted: 20000},
+		},
+		fMeta:   make(fileMap, 42),
+		total:   123456,
+		deleted: 40,
+		failed:  map[string]error{"/a/x.log": errors.New("busy"), "/b/y.log": errors.New("busy")},
+	}
+	for i := 0; i < 42; i++ {
+		m.fMeta[fmt.Sprintf("/a/%d.log", i)] = fileMeta{}
+	}
+
+	var out strings.Builder
+	m.reportPorcelain(&out)
+	want := "schema_version=1 files_matched=42 bytes_matched=123456 files_deleted=40 bytes_freed=120000 failures=2\n"
+	if out.String() != want {
+		t.Errorf("porcelain output changed:\n got %q\nwant %q", out.String(), want)
+	}
+}
+
+func TestPorcelainReplacesTables(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a.log":     "abc",
+		"sub/b.log": "12345",
+		"c.txt":     "keep",
+	})
+
+	out, err := runDelly(t, "y\n", "-e", "log", "--porcelain", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "schema_version=1 files_matched=2 bytes_matched=8 files_deleted=2 bytes_freed=8 failures=0\n"
+	if !strings.HasSuffix(out, want) {
+		t.Errorf("output does not end with the porcelain line:\n%s", out)
+	}
+	if strings.Contains(out, "TOTAL") || strings.Contains(out, "a.log") {
+		t.Errorf("output contains the human readable tables:\n%s", out)
+	}
+	if _, err := os.Stat(filepath.Join(root, "c.txt")); err != nil {
+		t.Errorf("non-matching file was deleted: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+// progress counts the work done so far by the walk and the deletion
+// workers. It is safe to update and read concurrently, and a nil *progress
+// ignores updates so callers that don't track progress need not create one.
+type progress struct {
+	scanned atomic.Int64
+	matched atomic.Int64
+	deleted atomic.Int64
+	freed   atomic.Int64
+}
+
+// progressSnapshot is a consistent-enough copy of progress at one point in
+// time; each counter is read atomically but not all of them at once.
+type progressSnapshot struct {
+	scanned, matched, deleted, freed int64
+}
+
+func (p *progress) fileScanned(matched bool) {
+	if p == nil {
+		return
+	}
+	p.scanned.Add(1)
+	if matched {
+		p.matched.Add(1)
+	}
+}
+
+func (p *progress) fileDeleted(size int64) {
+	if p == nil {
+		return
+	}
+	p.deleted.Add(1)
+	p.freed.Add(size)
+}
+
+// dirDeleted counts a directory deleted with everything in it as the files
+// it held.
+func (p *progress) dirDeleted(files int, size int64) {
+	if p == nil {
+		return
+	}
+	p.deleted.Add(int64(files))
+	p.freed.Add(size)
+}
+
+func (p *progress) snapshot() progressSnapshot {
+	if p == nil {
+		return progressSnapshot{}
+	}
+	return progressSnapshot{
+		scanned: p.scanned.Load(),
+		matched: p.matched.Load(),
+		deleted: p.deleted.Load(),
+		freed:   p.freed.Load(),
+	}
+}
+
+// reconcile checks the bytes and files deleted per directory in m, which the
+// reports and --verify add up, against the counters in p, which are updated
+// separately as each deletion succeeds. They can only disagree through a bug
+// in the accounting, so a mismatch is logged with both figures rather than
+// failing the run, and reconcile reports whether they agreed.
+func (m metadata) reconcile(p *progress) bool {
+	if p == nil {
+		return true
+	}
+
+	var files int64
+	for _, d := range m.dMeta {
+		files += int64(d.filesDeleted)
+	}
+	freed := m.freed()
+
+	s := p.snapshot()
+	if files == s.deleted && freed == s.freed {
+		return true
+	}
+
+	slog.Warn("the per-directory report does not add up to what was deleted; this is a bug in delly, please report it",
+		"report_files", files, "report_bytes", freed, "deleted_files", s.deleted, "deleted_bytes", s.freed)
+	return false
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProgressAfterDelete(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a.tmp":      "12345",
+		"sub/b.tmp":  "1234567890",
+		"sub/c.tmp":  "123",
+		"sub/d.txt":  "not matched",
+		"sub/e/f.go": "package f",
+	})
+	busy := filepath.Join(root, "sub", "c.tmp")
+
+	prog := &progress{}
+	meta, err := collectDirMetadata(context.Background(), root, walkOptions{exts: []string{"tmp"}, progress: prog})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := prog.snapshot(), (progressSnapshot{scanned: 5, matched: 3}); got != want {
+		t.Errorf("after the walk: got %+v, want %+v", got, want)
+	}
+
+	meta = deleteFilesByExtension(context.Background(), meta, deleteOptions{
+		remove: func(path string) error {
+			if path == busy {
+				return errors.New("busy")
+			}
+			return os.Remove(path)
+		},
+		workers:   2,
+		batchSize: 1,
+		progress:  prog,
+	})
+	if len(meta.failed) != 1 {
+		t.Fatalf("failed to delete %v, want only %s", meta.failed, busy)
+	}
+
+	// The failed file is matched but neither deleted nor freed.
+	if got, want := prog.snapshot(), (progressSnapshot{scanned: 5, matched: 3, deleted: 2, freed: 15}); got != want {
+		t.Errorf("after deleting: got %+v, want %+v", got, want)
+	}
+	if !meta.reconcile(prog) {
+		t.Error("the report does not reconcile with the progress counters")
+	}
+}
+
+func TestReconcileMismatch(t *testing.T) {
+	meta := metadata{dMeta: dirMap{
+		"/a": {filesDeleted: 2, bytesDeleted: 30},
+		"/b": {filesDeleted: 1, bytesDeleted: 12},
+	}}
+
+	tests := []struct {
+		name  string
+		files int
+		bytes int64
+		want  bool
+	}{
+		{"equal", 3, 42, true},
+		{"missing file", 2, 42, false},
+		{"extra bytes", 3, 43, false},
+	}
+	for _, tt := range tests {
+		prog := &progress{}
+		prog.dirDeleted(tt.files, tt.bytes)
+		if got := meta.reconcile(prog); got != tt.want {
+			t.Errorf("%s: reconcile = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if !meta.reconcile(nil) {
+		t.Error("reconcile without progress reported a mismatch")
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// loadProtectList reads the files listed in the --protect-file at path, one
+// per line, skipping blank lines and lines starting with '#'. Relative paths
+// are taken relative to root, which is absolute, so the returned set can be
+// looked up with the paths the walk produces.
+func loadProtectList(path, root string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	protected := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(root, line)
+		}
+		protected[filepath.Clean(line)] = true
+	}
+	return protected, scanner.Err()
+}
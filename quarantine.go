@@ -0,0 +1,24 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// newQuarantiner returns a function that moves a file found under root to the
+// same relative path under dir. A file left there by an earlier run is
+// handled according to policy.
+func newQuarantiner(root, dir string, policy conflictPolicy) func(string) error {
+	return func(path string) error {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		dst := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return err
+		}
+		return moveTo(path, dst, policy)
+	}
+}
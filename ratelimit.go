@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"golang.org/x/time/rate"
+)
+
+// rateLimiter paces deletions either by number of files or by bytes per
+// second. It is shared by all workers, so the limit applies to the run as a
+// whole regardless of --workers.
+type rateLimiter struct {
+	limiter *rate.Limiter
+	bytes   bool
+}
+
+// parseRateLimit parses a limit such as "100" or "100/s" (files per second) or
+// "50MB" or "50MB/s" (bytes per second). An empty string means no limit.
+func parseRateLimit(s string) (*rateLimiter, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	v := strings.TrimSuffix(strings.TrimSpace(s), "/s")
+
+	if n, err := strconv.ParseFloat(v, 64); err == nil {
+		if n <= 0 {
+			return nil, fmt.Errorf("error invalid rate limit %q: must be positive", s)
+		}
+		return &rateLimiter{limiter: rate.NewLimiter(rate.Limit(n), max(1, int(n)))}, nil
+	}
+
+	n, err := humanize.ParseBytes(v)
+	if err != nil {
+		return nil, fmt.Errorf("error invalid rate limit %q: must be files or bytes per second, e.g. 100/s or 50MB/s", s)
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("error invalid rate limit %q: must be positive", s)
+	}
+
+	return &rateLimiter{limiter: rate.NewLimiter(rate.Limit(n), int(n)), bytes: true}, nil
+}
+
+// wait blocks until a file of the given size may be deleted. Files larger
+// than one second's worth of bytes take their tokens in several steps.
+func (r *rateLimiter) wait(ctx context.Context, size int64) error {
+	if r == nil {
+		return nil
+	}
+	n := int64(1)
+	if r.bytes {
+		n = size
+	}
+
+	burst := int64(r.limiter.Burst())
+	for n > 0 {
+		step := min(n, burst)
+		if err := r.limiter.WaitN(ctx, int(step)); err != nil {
+			// WaitN gives up early when the tokens would arrive after
+			// ctx's deadline. Nothing more can be deleted by then, so
+			// wait it out to report the same error as every other
+			// interrupted deletion.
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		n -= step
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+)
+
+// applyRC applies the rule file at path to the extension list inherited from
+// the parent directory and returns the list for the file's directory and
+// everything below it. Each non-empty line not starting with '#' has the form
+//
+//	ext = log,tmp   # replace the inherited extensions
+//	ext += bak      # add to the inherited extensions
+//	ext -= log      # remove from the inherited extensions
+//
+// A missing file leaves the inherited list unchanged. Every file applied is
+// logged, since it changes what is deleted without appearing on the command
+// line.
+func applyRC(path string, inherited []string) ([]string, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return inherited, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	exts := slices.Clone(inherited)
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, op, value, ok := splitRCLine(line)
+		if !ok || key != "ext" {
+			return nil, fmt.Errorf("error %s:%d: expected ext =, ext += or ext -=", path, n)
+		}
+
+		values, err := normalizeExts([]string{value})
+		if err != nil {
+			return nil, fmt.Errorf("error %s:%d: %w", path, n, err)
+		}
+
+		switch op {
+		case "=":
+			exts = values
+		case "+=":
+			exts = append(exts, values...)
+		case "-=":
+			exts = slices.DeleteFunc(exts, func(e string) bool {
+				return slices.Contains(values, e)
+			})
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	slog.Info("applying rule file", "path", path, "ext", strings.Join(exts, ","))
+	return exts, nil
+}
+
+// splitRCLine splits a rule line into its key, operator and value. A '#' at
+// the start of the value or after a space or tab starts a comment running to
+// the end of the line.
+func splitRCLine(line string) (key, op, value string, ok bool) {
+	i := strings.IndexByte(line, '=')
+	if i <= 0 {
+		return "", "", "", false
+	}
+
+	key, op = line[:i], "="
+	if c := key[len(key)-1]; c == '+' || c == '-' {
+		key, op = key[:len(key)-1], string(c)+"="
+	}
+
+	value = line[i+1:]
+	for j := 0; j < len(value); j++ {
+		if value[j] == '#' && (j == 0 || value[j-1] == ' ' || value[j-1] == '\t') {
+			value = value[:j]
+			break
+		}
+	}
+
+	return strings.TrimSpace(key), op, strings.TrimSpace(value), true
+}
@@ -0,0 +1,120 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/dustin/go-humanize"
+)
+
+var (
+	kernel32                              = syscall.NewLazyDLL("kernel32.dll")
+	procGetVolumePathNameW                = kernel32.NewProc("GetVolumePathNameW")
+	procGetVolumeNameForVolumeMountPointW = kernel32.NewProc("GetVolumeNameForVolumeMountPointW")
+	procGetDriveTypeW                     = kernel32.NewProc("GetDriveTypeW")
+)
+
+const driveRemote = 4
+
+// bitBucketKey holds the per-volume Recycle Bin settings under HKCU, in a
+// subkey named after the volume GUID.
+const bitBucketKey = `Software\Microsoft\Windows\CurrentVersion\Explorer\BitBucket\Volume\`
+
+// errNotRecyclable is returned for files SHFileOperationW would delete
+// permanently instead of recycling, which it does without telling anyone
+// given the flags recycle passes.
+var errNotRecyclable = errors.New("it would be deleted permanently instead of recycled")
+
+// recycleBin describes the Recycle Bin of one volume.
+type recycleBin struct {
+	// remote is set for network drives, which have no Recycle Bin.
+	remote bool
+	// disabled is set when the Recycle Bin is turned off for the volume.
+	disabled bool
+	// maxBytes is the size of the Recycle Bin, or 0 if it is unknown.
+	maxBytes uint64
+}
+
+// check returns an error wrapping errNotRecyclable if a file of size bytes
+// would not fit into b.
+func (b recycleBin) check(size int64) error {
+	switch {
+	case b.remote:
+		return fmt.Errorf("%w: network drives have no Recycle Bin", errNotRecyclable)
+	case b.disabled:
+		return fmt.Errorf("%w: the Recycle Bin is turned off for its drive", errNotRecyclable)
+	case b.maxBytes > 0 && size > 0 && uint64(size) > b.maxBytes:
+		return fmt.Errorf("%w: it is larger than the Recycle Bin (%s)", errNotRecyclable, humanize.Bytes(b.maxBytes))
+	}
+	return nil
+}
+
+// recycleBinFor looks up the Recycle Bin settings of the volume holding the
+// absolute path abs. Settings that cannot be read are left at their zero
+// value, so that only a known problem keeps a file from being recycled.
+func recycleBinFor(abs string) recycleBin {
+	var b recycleBin
+
+	p, err := syscall.UTF16PtrFromString(abs)
+	if err != nil {
+		return b
+	}
+	root := make([]uint16, syscall.MAX_PATH+1)
+	if r, _, _ := procGetVolumePathNameW.Call(uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&root[0])), uintptr(len(root))); r == 0 {
+		return b
+	}
+	if t, _, _ := procGetDriveTypeW.Call(uintptr(unsafe.Pointer(&root[0]))); t == driveRemote {
+		b.remote = true
+		return b
+	}
+
+	name := make([]uint16, 50)
+	if r, _, _ := procGetVolumeNameForVolumeMountPointW.Call(uintptr(unsafe.Pointer(&root[0])), uintptr(unsafe.Pointer(&name[0])), uintptr(len(name))); r == 0 {
+		return b
+	}
+	// The volume name looks like \\?\Volume{GUID}\.
+	guid := syscall.UTF16ToString(name)
+	i := strings.IndexByte(guid, '{')
+	if i < 0 {
+		return b
+	}
+	guid = strings.TrimSuffix(guid[i:], `\`)
+
+	key, err := syscall.UTF16PtrFromString(bitBucketKey + guid)
+	if err != nil {
+		return b
+	}
+	var h syscall.Handle
+	if err := syscall.RegOpenKeyEx(syscall.HKEY_CURRENT_USER, key, 0, syscall.KEY_READ, &h); err != nil {
+		return b
+	}
+	defer syscall.RegCloseKey(h)
+
+	if v, ok := regDword(h, "NukeOnDelete"); ok && v != 0 {
+		b.disabled = true
+	}
+	// MaxCapacity is in megabytes.
+	if v, ok := regDword(h, "MaxCapacity"); ok {
+		b.maxBytes = uint64(v) << 20
+	}
+	return b
+}
+
+// regDword reads the REG_DWORD value name of the open key h.
+func regDword(h syscall.Handle, name string) (uint32, bool) {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return 0, false
+	}
+	var v, typ uint32
+	n := uint32(unsafe.Sizeof(v))
+	if err := syscall.RegQueryValueEx(h, p, nil, &typ, (*byte)(unsafe.Pointer(&v)), &n); err != nil || typ != syscall.REG_DWORD {
+		return 0, false
+	}
+	return v, true
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFileReportAlignsSizes(t *testing.T) {
+	f := fileMap{
+		"/data/big.iso":   {size: 1200000000},
+		"/data/movie.mkv": {size: 900000000},
+		"/data/notes.tmp": {size: 5},
+		"/data/page.html": {size: 12000},
+	}
+
+	var out strings.Builder
+	if err := f.report(&out, 2100012005, listOptions{sortKey: "path"}); err != nil {
+		t.Fatal(err)
+	}
+	want := `FILE                SIZE
+----                ----
+/data/big.iso     1.2 GB
+/data/movie.mkv   900 MB
+/data/notes.tmp      5 B
+/data/page.html    12 kB
+----                ----
+TOTAL             2.1 GB
+
+`
+	if out.String() != want {
+		t.Errorf("file report:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestDirReportAlignsSizes(t *testing.T) {
+	d := dirMap{
+		"/data":       {size: 2100012005, bytesDeleted: 2100000000, filesDeleted: 2},
+		"/data/cache": {size: 12005, bytesDeleted: 5, filesDeleted: 1},
+		"/data/empty": {size: 0},
+	}
+
+	var out strings.Builder
+	if err := d.report(&out, listOptions{dirSortKey: "path"}); err != nil {
+		t.Fatal(err)
+	}
+	want := `DIRECTORY     OLDSIZE     NEWSIZE     BYTES SAVED
+---------     -------     -------     -----------
+/data          2.1 GB       12 kB          2.1 GB
+/data/cache     12 kB       12 kB             5 B
+
+`
+	if out.String() != want {
+		t.Errorf("directory report:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+)
+
+// keepNewest drops the n most recently modified files from the matches so
+// that they are not deleted, reporting each to onSkip if it is not nil. The
+// matches of the whole tree are already held in m.fMeta, so this needs no
+// memory beyond the sorted path list.
+func (m metadata) keepNewest(n int, onSkip func(string, skipReason)) metadata {
+	paths := m.fMeta.sorted("mtime", true)
+	if n > len(paths) {
+		n = len(paths)
+	}
+
+	for _, path := range paths[:n] {
+		if !m.noTotal {
+			m.total -= m.fMeta[path].size
+		}
+		delete(m.fMeta, path)
+		if onSkip != nil {
+			onSkip(path, skipNewest)
+		}
+	}
+
+	return m
+}
+
+// keepForTarget keeps only the oldest files whose sizes add up to need bytes,
+// dropping the newer ones from the matches and reporting each to onSkip if it
+// is not nil.
+func (m metadata) keepForTarget(need int64, onSkip func(string, skipReason)) metadata {
+	var sum int64
+	for _, path := range m.fMeta.sorted("mtime", false) {
+		if sum < need {
+			sum += m.fMeta[path].size
+			continue
+		}
+
+		if !m.noTotal {
+			m.total -= m.fMeta[path].size
+		}
+		delete(m.fMeta, path)
+		if onSkip != nil {
+			onSkip(path, skipTargetReached)
+		}
+	}
+
+	return m
+}
+
+// parseLimits parses --limit values such as "log:1GB,tmp:500MB" into the
+// number of bytes that may be deleted per extension.
+func parseLimits(values []string) (map[string]int64, error) {
+	limits := make(map[string]int64)
+	for _, v := range values {
+		for _, tok := range strings.Split(v, ",") {
+			if tok = strings.TrimSpace(tok); tok == "" {
+				continue
+			}
+
+			ext, size, ok := strings.Cut(tok, ":")
+			ext = strings.TrimPrefix(strings.TrimSpace(ext), ".")
+			if !ok || ext == "" {
+				return nil, fmt.Errorf("error invalid --limit %q: expected <extension>:<size>, e.g. log:1GB", tok)
+			}
+			n, err := humanize.ParseBytes(strings.TrimSpace(size))
+			if err != nil {
+				return nil, fmt.Errorf("error invalid --limit %q: %w", tok, err)
+			}
+			limits[ext] = int64(n)
+		}
+	}
+	return limits, nil
+}
+
+// limitPerExt keeps, for every extension in limits, only its oldest files
+// whose sizes add up to at most the limit, dropping the rest from the
+// matches and reporting each to onSkip if it is not nil. Files are taken
+// strictly oldest first, so a file that doesn't fit stops the extension.
+// Extensions without a limit are left alone.
+func (m metadata) limitPerExt(limits map[string]int64, opts listOptions, onSkip func(string, skipReason)) metadata {
+	sums := make(map[string]int64)
+	full := make(map[string]bool)
+	for _, path := range m.fMeta.sorted("mtime", false) {
+		ext := opts.ext(path)
+		limit, ok := limits[ext]
+		if !ok {
+			continue
+		}
+
+		size := m.fMeta[path].size
+		if !full[ext] && sums[ext]+size <= limit {
+			sums[ext] += size
+			continue
+		}
+		full[ext] = true
+
+		if !m.noTotal {
+			m.total -= size
+		}
+		delete(m.fMeta, path)
+		if onSkip != nil {
+			onSkip(path, skipLimitReached)
+		}
+	}
+
+	return m
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+const retryBaseDelay = 100 * time.Millisecond
+
+// isTransient reports whether err is worth retrying. Anything not known to be
+// transient, such as ENOENT or EPERM, is treated as permanent.
+func isTransient(err error) bool {
+	return errors.Is(err, syscall.EBUSY) ||
+		errors.Is(err, syscall.ETXTBSY) ||
+		errors.Is(err, syscall.EAGAIN) ||
+		errors.Is(err, syscall.EINTR) ||
+		os.IsTimeout(err) ||
+		isTransientPlatform(err)
+}
+
+// removeWithRetry calls remove, retrying transient failures up to retries
+// times and doubling the delay between attempts. It stops waiting once ctx
+// is done and returns the last failure.
+func removeWithRetry(ctx context.Context, remove func(string) error, path string, retries int) error {
+	delay := retryBaseDelay
+
+	err := remove(path)
+	for i := 0; i < retries && err != nil && isTransient(err); i++ {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+		err = remove(path)
+	}
+
+	return err
+}
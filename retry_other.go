@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+// isTransientPlatform reports whether err is a transient error specific to
+// the platform. Unix has none beyond those isTransient checks.
+func isTransientPlatform(err error) bool {
+	return false
+}
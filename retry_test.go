@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// failingRemove returns a remove function that fails with err the first
+// failures times it is called and counts its calls in calls.
+func failingRemove(err error, failures int, calls *int) func(string) error {
+	return func(path string) error {
+		*calls++
+		if *calls <= failures {
+			return &os.PathError{Op: "remove", Path: path, Err: err}
+		}
+		return nil
+	}
+}
+
+func TestRemoveWithRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		failures int
+		retries  int
+		calls    int
+		ok       bool
+	}{
+		{"transient then success", syscall.EBUSY, 2, 3, 3, true},
+		{"transient past retries", syscall.EBUSY, 5, 2, 3, false},
+		{"no retries", syscall.EBUSY, 1, 0, 1, false},
+		{"permanent", fs.ErrNotExist, 1, 3, 1, false},
+		{"permission", fs.ErrPermission, 1, 3, 1, false},
+	}
+	for _, tt := range tests {
+		var calls int
+		err := removeWithRetry(context.Background(), failingRemove(tt.err, tt.failures, &calls), "f.log", tt.retries)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v, want success %v", tt.name, err, tt.ok)
+		}
+		if calls != tt.calls {
+			t.Errorf("%s: remove called %d times, want %d", tt.name, calls, tt.calls)
+		}
+	}
+}
+
+func TestRemoveWithRetryStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var calls int
+	start := time.Now()
+	err := removeWithRetry(ctx, failingRemove(syscall.EBUSY, 10, &calls), "f.log", 10)
+	if err == nil {
+		t.Fatal("removeWithRetry succeeded after ctx was done")
+	}
+	if calls != 1 {
+		t.Errorf("remove called %d times after ctx was done, want 1", calls)
+	}
+	if d := time.Since(start); d > retryBaseDelay {
+		t.Errorf("removeWithRetry waited %v after ctx was done", d)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+const (
+	// errorSharingViolation is ERROR_SHARING_VIOLATION, returned while
+	// another process has the file open without FILE_SHARE_DELETE, as
+	// virus scanners and indexers briefly do.
+	errorSharingViolation = syscall.Errno(32)
+	// errorLockViolation is ERROR_LOCK_VIOLATION, returned while another
+	// process holds a lock on part of the file.
+	errorLockViolation = syscall.Errno(33)
+)
+
+// isTransientPlatform reports whether err is a transient error specific to
+// Windows, where files in use by another process cannot be deleted.
+func isTransientPlatform(err error) bool {
+	return errors.Is(err, errorSharingViolation) || errors.Is(err, errorLockViolation)
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestIsTransientWindows(t *testing.T) {
+	for _, errno := range []error{errorSharingViolation, errorLockViolation} {
+		if err := (&os.PathError{Op: "remove", Path: "f.log", Err: errno}); !isTransient(err) {
+			t.Errorf("isTransient(%v) = false", err)
+		}
+	}
+}
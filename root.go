@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// expandRoot expands a root given as a glob pattern, such as
+// '/var/app-*/logs', into the directories it matches. A root that exists as
+// given or has no glob metacharacters is used as is, so that a missing
+// directory is reported like before.
+func expandRoot(pattern string) ([]string, error) {
+	if _, err := os.Lstat(pattern); err == nil || !strings.ContainsAny(pattern, "*?[") {
+		return []string{pattern}, nil
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("error invalid root pattern %q: %w", pattern, err)
+	}
+
+	var roots []string
+	for _, m := range matches {
+		if info, err := os.Stat(m); err == nil && info.IsDir() {
+			roots = append(roots, m)
+		}
+	}
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("error root pattern %q matches no directories", pattern)
+	}
+
+	return roots, nil
+}
+
+// dedupeRoots drops the roots that, once made absolute and with symlinks
+// resolved, are the same as or lie below another root, so that no file is
+// scanned or counted twice. It returns the roots kept in their original
+// order along with their resolved paths.
+func dedupeRoots(roots []string) ([]string, []string) {
+	resolved := make([]string, len(roots))
+	for i, r := range roots {
+		resolved[i] = r
+		if abs, err := filepath.Abs(r); err == nil {
+			resolved[i] = abs
+		}
+		if real, err := filepath.EvalSymlinks(resolved[i]); err == nil {
+			resolved[i] = real
+		}
+	}
+
+	// Shorter paths first, so that a root is checked only against the
+	// ones that could contain it.
+	order := make([]int, len(roots))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return len(resolved[order[a]]) < len(resolved[order[b]])
+	})
+
+	drop := make([]bool, len(roots))
+	for n, i := range order {
+		for _, j := range order[:n] {
+			if !drop[j] && within(resolved[i], resolved[j]) {
+				slog.Warn("skipping root already covered by another root", "root", roots[i], "covered_by", roots[j])
+				drop[i] = true
+				break
+			}
+		}
+	}
+
+	var kept, keptResolved []string
+	for i := range roots {
+		if !drop[i] {
+			kept = append(kept, roots[i])
+			keptResolved = append(keptResolved, resolved[i])
+		}
+	}
+	return kept, keptResolved
+}
+
+// commonDir returns the deepest directory containing all of paths, which
+// must be clean absolute paths.
+func commonDir(paths []string) string {
+	common := paths[0]
+	for _, p := range paths[1:] {
+		for !within(p, common) {
+			parent := filepath.Dir(common)
+			if parent == common {
+				break
+			}
+			common = parent
+		}
+	}
+	return common
+}
+
+// singleRootFlags lists the flags naming one file or directory that
+// describes a single root: a run over several roots would overwrite it with
+// each root in turn, or refuse every root but the one it was written for.
+var singleRootFlags = []string{
+	"manifest", "archive", "save-plan", "compare-plan", "state-file", "resume", "output-dir",
+}
+
+// checkSingleRootFlags refuses flags from singleRootFlags when pattern
+// expanded to several roots.
+func checkSingleRootFlags(ctx *cli.Context, pattern string, roots []string) error {
+	if len(roots) < 2 {
+		return nil
+	}
+	for _, name := range singleRootFlags {
+		if ctx.IsSet(name) {
+			return fmt.Errorf("error invalid flags: --%s describes a single directory, but %s matches %d; run delly once per directory", name, pattern, len(roots))
+		}
+	}
+	return nil
+}
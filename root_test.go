@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDedupeRootsKeepsSiblingsWithSameSubdirs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"app-1/logs/x.log": "",
+		"app-2/logs/x.log": "",
+	})
+	a, b := filepath.Join(dir, "app-1"), filepath.Join(dir, "app-2")
+
+	roots, _ := dedupeRoots([]string{a, b, filepath.Join(a, "logs")})
+	if want := []string{a, b}; !reflect.DeepEqual(roots, want) {
+		t.Errorf("dedupeRoots kept %q, want %q", roots, want)
+	}
+}
+
+func TestCommonDir(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "srv")
+	tests := []struct {
+		paths []string
+		want  string
+	}{
+		{[]string{filepath.Join(root, "app-1"), filepath.Join(root, "app-2")}, root},
+		{[]string{filepath.Join(root, "app-1", "logs"), filepath.Join(root, "app-2", "logs")}, root},
+		{[]string{filepath.Join(root, "app"), filepath.Join(root, "app-2")}, root},
+		{[]string{filepath.Join(root, "a", "b"), filepath.Join(root, "a", "c")}, filepath.Join(root, "a")},
+	}
+	for _, tt := range tests {
+		if got := commonDir(tt.paths); got != tt.want {
+			t.Errorf("commonDir(%q) = %q, want %q", tt.paths, got, tt.want)
+		}
+	}
+}
+
+func TestRootsWithSameSubdirsAccountedSeparately(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"app-1/logs/x.log": "111",
+		"app-2/logs/x.log": "22222",
+	})
+	quarantine := filepath.Join(t.TempDir(), "q")
+
+	out, err := runDelly(t, "y\ny\n", "-e", "log", "--quarantine-dir", quarantine, filepath.Join(dir, "app-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each root reports its own logs directory with only its own bytes.
+	for _, row := range [][]string{
+		{filepath.Join(dir, "app-1", "logs"), "3 B"},
+		{filepath.Join(dir, "app-2", "logs"), "5 B"},
+	} {
+		var found bool
+		for _, line := range strings.Split(out, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) > 0 && fields[0] == row[0] {
+				found = true
+				if !strings.HasSuffix(line, row[1]) {
+					t.Errorf("%s saved other than %s: %q", row[0], row[1], line)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("no directory row for %s:\n%s", row[0], out)
+		}
+	}
+
+	// The files at the same relative path in each root don't collide in
+	// the quarantine directory.
+	for name, want := range map[string]string{"app-1/logs/x.log": "111", "app-2/logs/x.log": "22222"} {
+		got, err := os.ReadFile(filepath.Join(quarantine, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("%s not quarantined: %v", name, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("quarantined %s holds %q, want %q", name, got, want)
+		}
+	}
+}
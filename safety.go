@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// within reports whether path is dir or lies below it. Both must be clean
+// absolute paths.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// checkCWD refuses a root above the current working directory: deleting
+// there can remove files out from under the shell or programs running in
+// the working directory. The working directory itself is a fine root.
+func checkCWD(root string) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil
+	}
+	if resolved, err := filepath.EvalSymlinks(cwd); err == nil {
+		cwd = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+
+	if cwd != root && within(cwd, root) {
+		return fmt.Errorf("error %s contains the current working directory %s; use --force to scan it anyway", root, cwd)
+	}
+	return nil
+}
+
+// checkMountPoint refuses a root that is the top of a mounted filesystem,
+// which is more often a whole disk than the directory that was meant.
+// Mount points are found by the root's device differing from its parent's,
+// which is only known on Unix-like systems; "/" always counts as one.
+func checkMountPoint(root string) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil
+	}
+	dev, ok := deviceID(info)
+	if !ok {
+		return nil
+	}
+
+	parent := filepath.Dir(root)
+	if parent != root {
+		pinfo, err := os.Stat(parent)
+		if err != nil {
+			return nil
+		}
+		if pdev, _ := deviceID(pinfo); pdev == dev {
+			return nil
+		}
+	}
+	return fmt.Errorf("error %s is a mount point; use --force to scan the whole filesystem anyway", root)
+}
+
+// checkExecutable refuses to delete the running delly binary.
+func (m metadata) checkExecutable() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+
+	if _, ok := m.fMeta[exe]; ok {
+		return fmt.Errorf("error the delly binary %s is among the files to delete; use --force to delete it anyway", exe)
+	}
+	for dir := range m.extDirs {
+		if within(exe, dir) {
+			return fmt.Errorf("error the delly binary %s is in %s, which is among the directories to delete; use --force to delete it anyway", exe, dir)
+		}
+	}
+	return nil
+}
+
+// checkAllowed refuses the run if any match, file or directory, lies
+// outside every one of the allowed directories. Both the paths as found under
+// root and with symlinks in root resolved are checked, so an allowed
+// directory may be given either way.
+func (m metadata) checkAllowed(root string, allowed []string) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		realRoot = root
+	}
+
+	var dirs []string
+	for _, d := range allowed {
+		abs, err := filepath.Abs(d)
+		if err != nil {
+			return err
+		}
+		dirs = append(dirs, abs)
+		if resolved, err := filepath.EvalSymlinks(abs); err == nil && resolved != abs {
+			dirs = append(dirs, resolved)
+		}
+	}
+
+	paths := make([]string, 0, len(m.fMeta)+len(m.extDirs))
+	for path := range m.fMeta {
+		paths = append(paths, path)
+	}
+	for path := range m.extDirs {
+		paths = append(paths, path)
+	}
+
+	var outside []string
+	for _, path := range paths {
+		real := path
+		if rel, err := filepath.Rel(root, path); err == nil {
+			real = filepath.Join(realRoot, rel)
+		}
+
+		ok := false
+		for _, d := range dirs {
+			if within(path, d) || within(real, d) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			outside = append(outside, path)
+		}
+	}
+
+	if len(outside) > 0 {
+		sort.Strings(outside)
+		return fmt.Errorf("error %d matches are outside every --allow-dir, e.g. %s; refusing to delete anything", len(outside), outside[0])
+	}
+	return nil
+}
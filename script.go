@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+)
+
+var scriptShells = []string{"sh", "powershell"}
+
+func validScriptShell(shell string) error {
+	for _, s := range scriptShells {
+		if s == shell {
+			return nil
+		}
+	}
+	return fmt.Errorf("error invalid script shell %q: must be one of %v", shell, scriptShells)
+}
+
+// defaultScriptShell is the shell --emit-script writes for unless
+// --script-shell says otherwise.
+func defaultScriptShell() string {
+	if runtime.GOOS == "windows" {
+		return "powershell"
+	}
+	return "sh"
+}
+
+// shQuote quotes s as a single POSIX shell word. Everything but a single
+// quote is literal between single quotes, newlines included.
+func shQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// psQuote quotes s as a PowerShell verbatim string, in which only a single
+// quote needs escaping, by doubling it.
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// writeScript writes a script for shell that deletes the matches under root,
+// one command per file, for the user to review and run themselves. It
+// touches nothing on disk.
+func (m metadata) writeScript(out io.Writer, shell, root string) error {
+	w := bufio.NewWriter(out)
+
+	var quote func(string) string
+	var command string
+	switch shell {
+	case "sh":
+		fmt.Fprintln(w, "#!/bin/sh")
+		quote, command = shQuote, "rm -f -- %s\n"
+	case "powershell":
+		quote, command = psQuote, "Remove-Item -LiteralPath %s -Force\n"
+	}
+
+	fmt.Fprintf(w, "# Generated by delly %s for %s.\n", version, root)
+	if m.noTotal {
+		fmt.Fprintf(w, "# Deletes %d files. Review it before running it.\n", len(m.fMeta))
+	} else {
+		fmt.Fprintf(w, "# Deletes %d files (%s). Review it before running it.\n",
+			len(m.fMeta), humanize.Bytes(uint64(m.total)))
+	}
+	for _, path := range m.fMeta.sorted("path", false) {
+		fmt.Fprintf(w, command, quote(path))
+	}
+
+	return w.Flush()
+}
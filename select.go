@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dustin/go-humanize"
+)
+
+const selectHelp = "toggle files by number (e.g. 2 or 3-5), a selects all, n selects none, d deletes the selected files, q quits"
+
+// selectFiles lets the user pick which of the matches to delete, one file at
+// a time. Every file starts out selected. It returns the matches narrowed to
+// the selection and false if the user quit instead.
+func (m metadata) selectFiles(reader *bufio.Reader, out io.Writer, opts listOptions) (metadata, bool, error) {
+	paths := m.fMeta.sorted(opts.sortKey, opts.reverse)
+	selected := make([]bool, len(paths))
+	for i := range selected {
+		selected[i] = true
+	}
+
+	for {
+		w := tabwriter.NewWriter(out, 0, 1, 2, ' ', 0)
+		for i, path := range paths {
+			mark := " "
+			if selected[i] {
+				mark = "x"
+			}
+			fmt.Fprintf(w, "%d\t[%s]\t%s\t%s\n", i+1, mark, opts.display(path), humanize.Bytes(uint64(m.fMeta[path].size)))
+		}
+		if err := w.Flush(); err != nil {
+			return m, false, err
+		}
+
+		fmt.Fprintf(out, "\n%s: ", selectHelp)
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			return m, false, fmt.Errorf("error reading selection: %w", err)
+		}
+		fmt.Fprint(out, "\n")
+
+		switch response = strings.ToLower(strings.TrimSpace(response)); response {
+		case "q":
+			return m, false, nil
+		case "a", "n":
+			for i := range selected {
+				selected[i] = response == "a"
+			}
+		case "d":
+			for i, path := range paths {
+				if selected[i] {
+					continue
+				}
+				if !m.noTotal {
+					m.total -= m.fMeta[path].size
+				}
+				delete(m.fMeta, path)
+			}
+			return m, true, nil
+		default:
+			for _, field := range strings.FieldsFunc(response, func(r rune) bool { return r == ',' || r == ' ' }) {
+				lo, hi, err := parseSelection(field, len(paths))
+				if err != nil {
+					fmt.Fprintf(out, "%v\n\n", err)
+					break
+				}
+				for i := lo; i <= hi; i++ {
+					selected[i-1] = !selected[i-1]
+				}
+			}
+		}
+	}
+}
+
+// parseSelection parses a file number or an inclusive range of them such as
+// "3-5", each between 1 and n.
+func parseSelection(s string, n int) (lo, hi int, err error) {
+	a, b, isRange := strings.Cut(s, "-")
+
+	lo, err = strconv.Atoi(a)
+	hi = lo
+	if err == nil && isRange {
+		hi, err = strconv.Atoi(b)
+	}
+	if err != nil || lo < 1 || hi > n || lo > hi {
+		return 0, 0, fmt.Errorf("invalid selection %q: must be a number or range between 1 and %d", s, n)
+	}
+
+	return lo, hi, nil
+}
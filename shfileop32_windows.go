@@ -0,0 +1,25 @@
+//go:build windows && (386 || arm)
+
+package main
+
+import "encoding/binary"
+
+// shFileOpStruct mirrors SHFILEOPSTRUCTW, which 32-bit Windows byte packs, so
+// fAnyOperationsAborted starts right after fFlags at offset 18 rather than at
+// the 20 Go would align an int32 to. The fields from there on are byte arrays
+// to keep Go from inserting that padding; none of them are set here.
+type shFileOpStruct struct {
+	hwnd                  uintptr
+	wFunc                 uint32
+	pFrom                 *uint16
+	pTo                   *uint16
+	fFlags                uint16
+	fAnyOperationsAborted [4]byte
+	hNameMappings         [4]byte
+	lpszProgressTitle     [4]byte
+}
+
+// aborted reports whether SHFileOperationW stopped before finishing.
+func (op *shFileOpStruct) aborted() bool {
+	return binary.LittleEndian.Uint32(op.fAnyOperationsAborted[:]) != 0
+}
@@ -0,0 +1,21 @@
+//go:build windows && !386 && !arm
+
+package main
+
+// shFileOpStruct mirrors SHFILEOPSTRUCTW, which 64-bit Windows lays out with
+// natural alignment, as Go does.
+type shFileOpStruct struct {
+	hwnd                  uintptr
+	wFunc                 uint32
+	pFrom                 *uint16
+	pTo                   *uint16
+	fFlags                uint16
+	fAnyOperationsAborted int32
+	hNameMappings         uintptr
+	lpszProgressTitle     *uint16
+}
+
+// aborted reports whether SHFileOperationW stopped before finishing.
+func (op *shFileOpStruct) aborted() bool {
+	return op.fAnyOperationsAborted != 0
+}
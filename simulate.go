@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"syscall"
+)
+
+// simulateErrors wraps remove so that about fraction of the paths fail with a
+// synthetic EBUSY without being touched. The choice is made from a hash of
+// the path, so the same files fail on every attempt and every run, which lets
+// tests exercise retries and failure reporting deterministically.
+func simulateErrors(remove func(string) error, fraction float64) func(string) error {
+	return func(path string) error {
+		h := fnv.New32a()
+		h.Write([]byte(path))
+		if float64(h.Sum32()%1000) < fraction*1000 {
+			return fmt.Errorf("simulated error removing %s: %w", path, syscall.EBUSY)
+		}
+		return remove(path)
+	}
+}
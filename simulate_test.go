@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// simulateTree writes n .tmp files below a fresh directory and returns the
+// directory, with symlinks resolved as delly resolves the root, and the
+// paths of the files.
+func simulateTree(t *testing.T, n int) (string, []string) {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string, n)
+	paths := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("sub/f%02d.tmp", i)
+		files[name] = "tmp"
+		paths = append(paths, filepath.Join(root, filepath.FromSlash(name)))
+	}
+	writeFiles(t, root, files)
+	return root, paths
+}
+
+// wantExitStatus1 fails t unless err makes delly exit with status 1, as
+// main does for any error that does not carry its own exit code.
+func wantExitStatus1(t *testing.T, err error) {
+	t.Helper()
+	if err == nil {
+		t.Fatal("run succeeded, want a failure")
+	}
+	var ec cli.ExitCoder
+	if errors.As(err, &ec) {
+		t.Fatalf("run exits with status %d, want 1: %v", ec.ExitCode(), err)
+	}
+}
+
+func TestSimulateErrorsAll(t *testing.T) {
+	root, paths := simulateTree(t, 5)
+
+	out, err := runDelly(t, "y\n", "-e", "tmp", "--report-only-failures", "--retries", "0", "--simulate-errors", "1", root)
+	wantExitStatus1(t, err)
+	if want := fmt.Sprintf("%d of %d files could not be deleted", len(paths), len(paths)); !strings.Contains(err.Error(), want) {
+		t.Errorf("error %q does not say %q", err, want)
+	}
+
+	for _, path := range paths {
+		if !strings.Contains(out, path) {
+			t.Errorf("%s is not listed as failed:\n%s", path, out)
+		}
+		if _, err := os.Lstat(path); err != nil {
+			t.Errorf("%s was touched by a simulated failure: %v", path, err)
+		}
+	}
+	if !strings.Contains(out, "simulated error") {
+		t.Errorf("failure list does not give the error:\n%s", out)
+	}
+}
+
+func TestSimulateErrorsFraction(t *testing.T) {
+	root, paths := simulateTree(t, 40)
+
+	// Which paths fail depends only on the path, so ask the same function.
+	fails := simulateErrors(func(string) error { return nil }, 0.3)
+	var failing int
+	for _, path := range paths {
+		if fails(path) != nil {
+			failing++
+		}
+	}
+	if failing == 0 || failing == len(paths) {
+		t.Fatalf("%d of %d paths fail, want some but not all", failing, len(paths))
+	}
+
+	out, err := runDelly(t, "y\n", "-e", "tmp", "--report-only-failures", "--retries", "0", "--simulate-errors", "0.3", root)
+	wantExitStatus1(t, err)
+	if want := fmt.Sprintf("%d of %d files could not be deleted", failing, len(paths)); !strings.Contains(err.Error(), want) {
+		t.Errorf("error %q does not say %q", err, want)
+	}
+
+	for _, path := range paths {
+		_, statErr := os.Lstat(path)
+		if fails(path) != nil {
+			if statErr != nil {
+				t.Errorf("%s should have failed but is gone: %v", path, statErr)
+			}
+			if !strings.Contains(out, path) {
+				t.Errorf("%s is not listed as failed:\n%s", path, out)
+			}
+			continue
+		}
+		if !os.IsNotExist(statErr) {
+			t.Errorf("%s should have been deleted: %v", path, statErr)
+		}
+		if strings.Contains(out, path) {
+			t.Errorf("deleted %s is listed as failed:\n%s", path, out)
+		}
+	}
+}
+
+func TestSimulateErrorsRetries(t *testing.T) {
+	root, _ := simulateTree(t, 1)
+
+	// A simulated EBUSY is transient, so each retry waits first: 100ms and
+	// then 200ms with two retries.
+	start := time.Now()
+	_, err := runDelly(t, "y\n", "-e", "tmp", "--retries", "2", "--simulate-errors", "1", root)
+	wantExitStatus1(t, err)
+	if elapsed, want := time.Since(start), 3*retryBaseDelay; elapsed < want {
+		t.Errorf("run took %v, want at least %v for two retries", elapsed, want)
+	}
+}
+
+func TestSimulateErrorsFailFast(t *testing.T) {
+	root, paths := simulateTree(t, 10)
+
+	out, err := runDelly(t, "y\n", "-e", "tmp", "--report-only-failures", "--retries", "0", "--fail-fast", "--workers", "1", "--simulate-errors", "1", root)
+	wantExitStatus1(t, err)
+	if want := fmt.Sprintf("(--fail-fast): deleted 0 of %d files", len(paths)); !strings.Contains(err.Error(), want) {
+		t.Errorf("error %q does not say %q", err, want)
+	}
+
+	var listed int
+	for _, path := range paths {
+		if strings.Contains(out, path) {
+			listed++
+		}
+		if _, err := os.Lstat(path); err != nil {
+			t.Errorf("%s is gone: %v", path, err)
+		}
+	}
+	if listed != 1 {
+		t.Errorf("%d files are listed as failed, want only the first one:\n%s", listed, out)
+	}
+}
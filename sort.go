@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+var sortKeys = []string{"path", "size", "mtime"}
+
+func validSortKey(key string) error {
+	for _, k := range sortKeys {
+		if k == key {
+			return nil
+		}
+	}
+	return fmt.Errorf("error invalid sort key %q: must be one of %v", key, sortKeys)
+}
+
+var dirSortKeys = []string{"path", "saved"}
+
+func validDirSortKey(key string) error {
+	for _, k := range dirSortKeys {
+		if k == key {
+			return nil
+		}
+	}
+	return fmt.Errorf("error invalid directory sort key %q: must be one of %v", key, dirSortKeys)
+}
+
+// sorted returns the paths in f ordered by key in ascending order (smallest or
+// oldest first), ties broken by path. reverse flips the final order.
+func (f fileMap) sorted(key string, reverse bool) []string {
+	paths := make([]string, 0, len(f))
+	for p := range f {
+		paths = append(paths, p)
+	}
+
+	less := func(i, j int) bool {
+		a, b := f[paths[i]], f[paths[j]]
+		switch key {
+		case "size":
+			if a.size != b.size {
+				return a.size < b.size
+			}
+		case "mtime":
+			if !a.modTime.Equal(b.modTime) {
+				return a.modTime.Before(b.modTime)
+			}
+		}
+		return paths[i] < paths[j]
+	}
+
+	if reverse {
+		sort.SliceStable(paths, func(i, j int) bool { return less(j, i) })
+	} else {
+		sort.SliceStable(paths, less)
+	}
+
+	return paths
+}
+
+// changed returns the directories in d from which files were deleted, ordered
+// by key ("path" or "saved") in ascending order, ties broken by path.
+func (d dirMap) changed(key string, reverse bool) []string {
+	var dirs []string
+	for k, v := range d {
+		if v.filesDeleted != 0 {
+			dirs = append(dirs, k)
+		}
+	}
+
+	less := func(i, j int) bool {
+		a, b := d[dirs[i]], d[dirs[j]]
+		if key == "saved" && a.bytesDeleted != b.bytesDeleted {
+			return a.bytesDeleted < b.bytesDeleted
+		}
+		return dirs[i] < dirs[j]
+	}
+
+	if reverse {
+		sort.SliceStable(dirs, func(i, j int) bool { return less(j, i) })
+	} else {
+		sort.SliceStable(dirs, less)
+	}
+
+	return dirs
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileMapSorted(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := fileMap{
+		"/a.log": {size: 30, modTime: base.Add(2 * time.Hour)},
+		"/b.log": {size: 10, modTime: base.Add(3 * time.Hour)},
+		"/c.log": {size: 20, modTime: base},
+		// Ties with /b.log on size and /c.log on mtime, broken by path.
+		"/d.log": {size: 10, modTime: base},
+	}
+
+	tests := []struct {
+		key     string
+		reverse bool
+		want    []string
+	}{
+		{"path", false, []string{"/a.log", "/b.log", "/c.log", "/d.log"}},
+		{"path", true, []string{"/d.log", "/c.log", "/b.log", "/a.log"}},
+		{"size", false, []string{"/b.log", "/d.log", "/c.log", "/a.log"}},
+		{"size", true, []string{"/a.log", "/c.log", "/d.log", "/b.log"}},
+		{"mtime", false, []string{"/c.log", "/d.log", "/a.log", "/b.log"}},
+		{"mtime", true, []string{"/b.log", "/a.log", "/d.log", "/c.log"}},
+	}
+	for _, tt := range tests {
+		if got := f.sorted(tt.key, tt.reverse); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sorted(%q, %v) = %q, want %q", tt.key, tt.reverse, got, tt.want)
+		}
+	}
+}
+
+func TestDirMapChanged(t *testing.T) {
+	d := dirMap{
+		"/a": {bytesDeleted: 300, filesDeleted: 1},
+		"/b": {bytesDeleted: 100, filesDeleted: 2},
+		"/c": {bytesDeleted: 200, filesDeleted: 1},
+		// Ties with /b on bytes saved, broken by path.
+		"/d": {bytesDeleted: 100, filesDeleted: 1},
+		// Nothing was deleted here, so it is never listed.
+		"/e": {size: 500},
+	}
+
+	tests := []struct {
+		key     string
+		reverse bool
+		want    []string
+	}{
+		{"path", false, []string{"/a", "/b", "/c", "/d"}},
+		{"path", true, []string{"/d", "/c", "/b", "/a"}},
+		{"saved", false, []string{"/b", "/d", "/c", "/a"}},
+		{"saved", true, []string{"/a", "/c", "/d", "/b"}},
+	}
+	for _, tt := range tests {
+		if got := d.changed(tt.key, tt.reverse); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("changed(%q, %v) = %q, want %q", tt.key, tt.reverse, got, tt.want)
+		}
+	}
+}
+
+func TestSortKeysAllTested(t *testing.T) {
+	// Extend the tables above when adding a key.
+	if want := []string{"path", "size", "mtime"}; !reflect.DeepEqual(sortKeys, want) {
+		t.Errorf("sortKeys = %q, want %q", sortKeys, want)
+	}
+	if want := []string{"path", "saved"}; !reflect.DeepEqual(dirSortKeys, want) {
+		t.Errorf("dirSortKeys = %q, want %q", dirSortKeys, want)
+	}
+}
+
+func TestReverseAppliesToBothReports(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"small/a.log": "1",
+		"big/b.log":   "1234567",
+		"mid/c.log":   "123",
+	})
+
+	out, err := runDelly(t, "y\n", "-e", "log", "--sort", "size", "--sort-dirs", "saved", "--reverse", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := func(names ...string) []int {
+		idx := make([]int, len(names))
+		for i, name := range names {
+			idx[i] = strings.Index(out, filepath.Join(root, filepath.FromSlash(name))+" ")
+		}
+		return idx
+	}
+	files := order("big/b.log", "mid/c.log", "small/a.log")
+	dirs := order("big", "mid", "small")
+	for _, idx := range [][]int{files, dirs} {
+		if idx[0] < 0 || idx[1] < idx[0] || idx[2] < idx[1] {
+			t.Fatalf("reports not largest first with --reverse:\n%s", out)
+		}
+	}
+	if dirs[0] < files[2] {
+		t.Fatalf("directory report does not follow the file report:\n%s", out)
+	}
+}
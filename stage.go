@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// staging holds files that have been removed from the scanned tree but not
+// yet deleted, so that the deletion can still be undone. The staging
+// directory is created inside root so that files can usually be renamed
+// rather than copied.
+type staging struct {
+	root string
+	dir  string
+
+	mu sync.Mutex
+	// moved holds the original paths of the files moved into dir.
+	moved []string
+}
+
+func newStaging(root string) (*staging, error) {
+	dir, err := os.MkdirTemp(root, ".delly-staging-")
+	if err != nil {
+		return nil, err
+	}
+	return &staging{root: root, dir: dir}, nil
+}
+
+// remove moves path into the staging directory. It is safe for concurrent
+// use by the deletion workers.
+func (s *staging) remove(path string) error {
+	if err := newQuarantiner(s.root, s.dir, conflictRename)(path); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.moved = append(s.moved, path)
+	s.mu.Unlock()
+	return nil
+}
+
+// restore moves every staged file back to its original location. Matches
+// that never reached the staging directory, because they failed, were
+// skipped or the run stopped early, are still where they were. The staging
+// directory is removed only if all files were restored.
+func (s *staging) restore() error {
+	var failed int
+	for _, path := range s.moved {
+		rel, err := filepath.Rel(s.root, path)
+		if err == nil {
+			err = moveFile(longPath(filepath.Join(s.dir, rel)), longPath(path))
+		}
+		if err != nil {
+			failed++
+			continue
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("error restoring files: %d files could not be restored and remain in %s", failed, s.dir)
+	}
+
+	return os.RemoveAll(s.dir)
+}
+
+func (s *staging) commit() error {
+	return os.RemoveAll(s.dir)
+}
+
+// undoDeletions resets the deletion accounting of m after staged files have
+// been restored.
+func (m metadata) undoDeletions() metadata {
+	for k, v := range m.dMeta {
+		v.bytesDeleted = 0
+		v.filesDeleted = 0
+		m.dMeta[k] = v
+	}
+	m.deleted = 0
+	return m
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestStageRestoreSkipsUnstagedFiles declines the staged deletion after
+// --fail-fast stopped the run with most matches never staged, and checks
+// every file ends up where it was.
+func TestStageRestoreSkipsUnstagedFiles(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{}
+	for i := 0; i < 20; i++ {
+		files[filepath.ToSlash(filepath.Join("sub", strings.Repeat("a", i+1)+".tmp"))] = "tmp"
+	}
+	writeFiles(t, root, files)
+
+	out, err := runDelly(t, "y\nn\n", "-e", "tmp", "--stage", "--fail-fast", "--workers", "1", "--simulate-errors", "0.5", root)
+	if err == nil || !strings.Contains(err.Error(), "--fail-fast") {
+		t.Fatalf("got error %v, want the --fail-fast error\n%s", err, out)
+	}
+
+	for name := range files {
+		if _, err := os.Lstat(filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			t.Errorf("%s is not back in place: %v", name, err)
+		}
+	}
+	staged, err := filepath.Glob(filepath.Join(root, ".delly-staging-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(staged) != 0 {
+		t.Errorf("staging directory was left behind: %v", staged)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const stateHeader = "# delly state schema_version=%d root=%s"
+
+// saveState writes the matched files that still exist to path, one per line
+// after a header naming root, so that an interrupted run can be continued
+// with --resume without walking the tree again.
+func (m metadata) saveState(path, root string) (int, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, stateHeader+"\n", schemaVersion, root)
+
+	var n int
+	for _, p := range m.fMeta.sorted("path", false) {
+		if _, err := os.Lstat(longPath(p)); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		fmt.Fprintln(w, p)
+		n++
+	}
+
+	err = w.Flush()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// loadState reads a file written by saveState for root and stats every file
+// listed in it again. A file outside root makes the whole state invalid.
+// Files that are gone by now, or that the walk would not match today, for
+// example because a keep marker or a --protect-file entry now covers them,
+// are left out. The sizes of their directories are recomputed from the
+// directories' current contents.
+func loadState(path, root string, walk walkOptions) (metadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return metadata{}, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		return metadata{}, fmt.Errorf("error reading state %s: empty file", path)
+	}
+
+	// The root may contain spaces, so it is everything after "root=".
+	head, saved, ok := strings.Cut(scanner.Text(), " root=")
+	var version int
+	if _, err := fmt.Sscanf(head, "# delly state schema_version=%d", &version); !ok || err != nil {
+		return metadata{}, fmt.Errorf("error reading state %s: invalid header", path)
+	}
+	if version != schemaVersion {
+		return metadata{}, fmt.Errorf("error reading state %s: unsupported schema version %d", path, version)
+	}
+	if saved != root {
+		return metadata{}, fmt.Errorf("error reading state %s: it was saved for %s, not %s", path, saved, root)
+	}
+
+	// --resume may be given without --ext, taking the extensions the state
+	// was saved with on trust.
+	walk.anyExt = len(walk.exts) == 0
+	dirExts := make(map[string][]string)
+
+	meta := metadata{dMeta: make(dirMap), fMeta: make(fileMap), noTotal: walk.noTotal}
+	for scanner.Scan() {
+		p := scanner.Text()
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		if !within(p, root) || p == root {
+			return metadata{}, fmt.Errorf("error reading state %s: %s is not under %s", path, p, root)
+		}
+
+		info, err := os.Lstat(longPath(p))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return metadata{}, err
+		}
+
+		o := walk
+		if o.rcFile != "" && !o.anyExt {
+			if o.exts, err = resumeExts(filepath.Dir(p), root, walk, dirExts); err != nil {
+				return metadata{}, err
+			}
+		}
+		reason := o.match(p, info)
+		if reason == matched && keptByMarker(p, root, walk) {
+			reason = skipKeepMarker
+		}
+		if reason != matched {
+			slog.Debug("skipping file", "path", p, "reason", reason.String())
+			if walk.onSkip != nil {
+				walk.onSkip(p, reason)
+			}
+			continue
+		}
+
+		f := newFileMeta(info)
+		meta.fMeta[p] = f
+		if !walk.noTotal {
+			meta.total += f.size
+		}
+
+		dir := filepath.Dir(p)
+		if _, ok := meta.dMeta[dir]; !ok {
+			meta.dMeta[dir] = dirMeta{size: dirSize(dir)}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return metadata{}, err
+	}
+
+	return meta, nil
+}
+
+// resumeExts returns the extensions the walk would match in dir, applying
+// the rule files from root down to dir to walk.exts.
+func resumeExts(dir, root string, walk walkOptions, cache map[string][]string) ([]string, error) {
+	if exts, ok := cache[dir]; ok {
+		return exts, nil
+	}
+
+	inherited := walk.exts
+	if dir != root {
+		var err error
+		if inherited, err = resumeExts(filepath.Dir(dir), root, walk, cache); err != nil {
+			return nil, err
+		}
+	}
+
+	exts, err := applyRC(filepath.Join(dir, walk.rcFile), inherited)
+	if err != nil {
+		return nil, err
+	}
+	cache[dir] = exts
+	return exts, nil
+}
+
+// keptByMarker reports whether a keep marker protects path: one in its own
+// directory or, with --keep-subtree, in any directory from root down.
+func keptByMarker(path, root string, walk walkOptions) bool {
+	if walk.keepMarker == "" {
+		return false
+	}
+	for dir := filepath.Dir(path); within(dir, root); dir = filepath.Dir(dir) {
+		if _, err := os.Lstat(filepath.Join(dir, walk.keepMarker)); err == nil {
+			return true
+		}
+		if !walk.keepSubtree || dir == root {
+			break
+		}
+	}
+	return false
+}
+
+// dirSize adds up the sizes of the files directly in dir, as the walk does.
+func dirSize(dir string) int64 {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+
+	var size int64
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd || windows)
+
+package main
+
+import "errors"
+
+func freeSpace(path string) (uint64, error) {
+	return 0, errors.New("free space cannot be queried on this platform")
+}
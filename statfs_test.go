@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd || windows
+
+package main
+
+import "testing"
+
+func TestFreeSpace(t *testing.T) {
+	free, err := freeSpace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if free == 0 {
+		t.Error("no free space reported for the temporary directory")
+	}
+
+	if _, err := freeSpace("does-not-exist"); err == nil {
+		t.Error("free space reported for a missing directory")
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"time"
+)
+
+var errStatTimeout = errors.New("timed out")
+
+// entryInfo returns the file info of d, giving up with errStatTimeout after
+// timeout, or never when timeout is 0. A stat on a hung network mount can
+// block forever; the goroutine making it is then left behind rather than
+// the walk, and exits if the stat ever returns.
+func entryInfo(d fs.DirEntry, timeout time.Duration) (fs.FileInfo, error) {
+	if timeout <= 0 {
+		return d.Info()
+	}
+
+	type result struct {
+		info fs.FileInfo
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		info, err := d.Info()
+		done <- result{info, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.info, r.err
+	case <-timer.C:
+		return nil, errStatTimeout
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime"
+)
+
+var storageKinds = []string{"auto", "hdd", "ssd"}
+
+// hddWorkers is the worker count for spinning disks, where concurrent
+// deletions mostly add seeks.
+const hddWorkers = 2
+
+// defaultWorkers returns the number of deletion workers to use for the
+// storage kind holding root when --workers is not given.
+func defaultWorkers(kind, root string) (int, error) {
+	switch kind {
+	case "hdd":
+		return hddWorkers, nil
+	case "ssd":
+		return runtime.NumCPU(), nil
+	case "auto":
+		rot, ok := rotational(root)
+		if !ok {
+			slog.Debug("could not detect storage type; assuming ssd", "path", root)
+			return runtime.NumCPU(), nil
+		}
+		slog.Debug("detected storage type", "path", root, "rotational", rot)
+		if rot {
+			return hddWorkers, nil
+		}
+		return runtime.NumCPU(), nil
+	default:
+		return 0, fmt.Errorf("error invalid storage type %q: must be one of %v", kind, storageKinds)
+	}
+}
@@ -0,0 +1,39 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// rotational reports whether path lives on a spinning disk, as told by
+// /sys/dev/block/<major>:<minor>. Partitions don't have a queue directory of
+// their own, so the parent device is consulted as well.
+func rotational(path string) (rot, ok bool) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return false, false
+	}
+
+	dev := uint64(st.Dev)
+	major := (dev>>8)&0xfff | (dev>>32)&^0xfff
+	minor := dev&0xff | (dev>>12)&^0xff
+	sys := fmt.Sprintf("/sys/dev/block/%d:%d", major, minor)
+
+	for _, p := range []string{
+		filepath.Join(sys, "queue", "rotational"),
+		filepath.Join(sys, "..", "queue", "rotational"),
+	} {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		return strings.TrimSpace(string(b)) == "1", true
+	}
+
+	return false, false
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package main
+
+func rotational(path string) (rot, ok bool) {
+	return false, false
+}
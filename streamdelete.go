@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// streamDeleteConflicts lists the flags that need every match to be known
+// before anything is deleted, which --stream-delete never waits for.
+var streamDeleteConflicts = []string{
+	"dry-run", "estimate", "resume", "state-file", "keep-newest", "target-free", "limit",
+	"max-files", "allow-dir", "invert", "select", "batch-confirm", "age-report",
+	"stage", "archive", "stream", "template", "summary-template", "group-by",
+	"tree", "flatten-report", "preview", "histogram", "projected-dirs", "preview-dirs",
+	"output-dir", "save-plan", "compare-plan", "emit-script",
+}
+
+func checkStreamDelete(ctx *cli.Context) error {
+	if !ctx.Bool("force") {
+		return errors.New("error invalid flags: --stream-delete deletes without asking for confirmation and requires --force")
+	}
+	for _, name := range streamDeleteConflicts {
+		if ctx.IsSet(name) {
+			return fmt.Errorf("error invalid flags: --stream-delete cannot be combined with --%s", name)
+		}
+	}
+	return nil
+}
+
+// streamDelete deletes the matches under rootDir as the walk finds them
+// rather than collecting them first, so memory use does not grow with the
+// number of matches. Only the per-directory accounting and the counters are
+// kept for the reports.
+func streamDelete(ctx *cli.Context, runCtx context.Context, rootDir, quarantineBase string, walk walkOptions, opts deleteOptions, out io.Writer, list listOptions) error {
+	var (
+		freeBefore uint64
+		err        error
+	)
+	verify := ctx.Bool("verify")
+	if verify {
+		freeBefore, err = freeSpace(rootDir)
+		if err != nil {
+			return fmt.Errorf("error verify: %w", err)
+		}
+	}
+
+	if f := ctx.Float64("simulate-errors"); f > 0 {
+		opts.remove = simulateErrors(opts.remove, f)
+	}
+
+	if path := ctx.String("manifest"); path != "" {
+		opts.manifest, err = createManifest(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	d := newDeleter(runCtx, opts)
+	walk.noKeep = true
+	walk.onMatch = func(path string, f fileMeta) {
+		d.add(path, f)
+	}
+
+	// The walk shares the deleter's context so that it stops along with the
+	// deletions on --max-runtime or --fail-fast.
+	meta, walkErr := collectDirMetadata(d.ctx, rootDir, walk)
+	if walkErr != nil && d.ctx.Err() == nil {
+		d.cancel()
+	}
+	meta = d.wait(meta)
+	meta.reconcile(opts.progress)
+
+	if ctx.Bool("porcelain") {
+		defer func() { meta.reportPorcelain(ctx.App.Writer) }()
+	}
+
+	if opts.manifest != nil {
+		if err := opts.manifest.Close(); err != nil {
+			return fmt.Errorf("error writing manifest: %w", err)
+		}
+	}
+
+	if walkErr != nil && !errors.Is(walkErr, context.Canceled) && !errors.Is(walkErr, context.DeadlineExceeded) {
+		return fmt.Errorf("error scanning %s after deleting %d files: %w", rootDir, meta.deleted, walkErr)
+	}
+
+	if meta.matched() == 0 {
+		fmt.Fprintln(out, "There is nothing to delete. Exiting...")
+		return nil
+	}
+
+	if err := meta.reportDirMetadata(out, list); err != nil {
+		return err
+	}
+
+	reportPaths(out, "files changed since they were matched and were not deleted", meta.changed, list)
+	reportPaths(out, "files were left in place because their destination already exists", meta.conflicts, list)
+	reportPaths(out, "files were modified after delly started and were not deleted", meta.tooNew, list)
+
+	if quarantineDir := ctx.String("quarantine-dir"); quarantineDir != "" {
+		fmt.Fprintf(out, "%d files moved to %s, keeping their paths relative to %s\n\n",
+			meta.deleted, quarantineDir, quarantineBase)
+	}
+
+	if verify {
+		freeAfter, err := freeSpace(rootDir)
+		if err != nil {
+			return fmt.Errorf("error verify: %w", err)
+		}
+		reportVerify(out, meta.freed(), freeBefore, freeAfter)
+	}
+
+	if path := ctx.String("history"); path != "" {
+		if err := meta.appendHistory(path, rootDir, time.Now()); err != nil {
+			return fmt.Errorf("error writing history: %w", err)
+		}
+	}
+
+	if ctx.Bool("report-only-failures") && len(meta.failed) > 0 {
+		if err := meta.reportFailures(ctx.App.Writer, list); err != nil {
+			return err
+		}
+	}
+
+	if errors.Is(walkErr, context.DeadlineExceeded) {
+		return fmt.Errorf("error max runtime of %s exceeded: deleted %d of the %d files matched so far",
+			ctx.Duration("max-runtime"), meta.deleted, meta.matched())
+	}
+
+	if len(meta.failed) > 0 && ctx.Bool("fail-fast") {
+		return fmt.Errorf("error stopped after a failed deletion (--fail-fast): deleted %d of the %d files matched so far",
+			meta.deleted, meta.matched())
+	}
+
+	if len(meta.failed) > 0 {
+		return fmt.Errorf("error deleting files: %d of %d files could not be deleted", len(meta.failed), meta.matched())
+	}
+
+	return nil
+}
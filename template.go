@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+type fileTemplateData struct {
+	Path      string
+	Size      int64
+	HumanSize string
+	Dir       string
+	Ext       string
+	ModTime   time.Time
+}
+
+type summaryTemplateData struct {
+	Count      int
+	Total      int64
+	HumanTotal string
+}
+
+// parseTemplate parses text and executes it once against a zero value of data
+// so that references to unknown fields are reported before the walk starts.
+func parseTemplate(name, text string, data any) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error invalid %s: %w", name, err)
+	}
+
+	if err := t.Execute(io.Discard, data); err != nil {
+		return nil, fmt.Errorf("error invalid %s: %w", name, err)
+	}
+
+	return t, nil
+}
+
+func (m metadata) reportTemplate(out io.Writer, fileTmpl, summaryTmpl *template.Template, opts listOptions) error {
+	if fileTmpl != nil {
+		for _, path := range m.fMeta.sorted(opts.sortKey, opts.reverse) {
+			f := m.fMeta[path]
+			data := fileTemplateData{
+				Path:      opts.display(path),
+				Size:      f.size,
+				HumanSize: humanize.Bytes(uint64(f.size)),
+				Dir:       opts.display(filepath.Dir(path)),
+				Ext:       opts.ext(path),
+				ModTime:   f.modTime,
+			}
+			if err := fileTmpl.Execute(out, data); err != nil {
+				return err
+			}
+			fmt.Fprint(out, "\n")
+		}
+	}
+
+	if summaryTmpl != nil {
+		data := summaryTemplateData{
+			Count:      len(m.fMeta),
+			Total:      m.total,
+			HumanTotal: humanize.Bytes(uint64(m.total)),
+		}
+		if err := summaryTmpl.Execute(out, data); err != nil {
+			return err
+		}
+		fmt.Fprint(out, "\n")
+	}
+
+	return nil
+}
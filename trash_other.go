@@ -0,0 +1,47 @@
+//go:build !windows
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const defaultTrashBackend = "gio"
+
+var trashBackends = []string{"gio", "xdg"}
+
+// newTrasher returns a function that moves a file to the trash using backend.
+// The gio backend falls back to the built-in XDG implementation when the gio
+// binary cannot be found.
+func newTrasher(backend string) (func(string) error, error) {
+	switch backend {
+	case "gio":
+		if gio, err := exec.LookPath("gio"); err == nil {
+			return func(path string) error { return gioTrash(gio, path) }, nil
+		}
+		return xdgTrash, nil
+	case "xdg":
+		return xdgTrash, nil
+	default:
+		return nil, fmt.Errorf("error invalid trash backend %q: must be one of %v", backend, trashBackends)
+	}
+}
+
+func gioTrash(gio, path string) error {
+	var stderr bytes.Buffer
+
+	cmd := exec.Command(gio, "trash", "--", path)
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("gio trash %s: %s", path, msg)
+		}
+		return fmt.Errorf("gio trash %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const defaultTrashBackend = "recyclebin"
+
+var trashBackends = []string{"recyclebin", "xdg"}
+
+var procSHFileOperationW = syscall.NewLazyDLL("shell32.dll").NewProc("SHFileOperationW")
+
+const (
+	foDelete = 0x3
+
+	fofSilent         = 0x4
+	fofNoConfirmation = 0x10
+	fofAllowUndo      = 0x40
+	fofNoErrorUI      = 0x400
+)
+
+// newTrasher returns a function that moves a file to the trash using backend.
+// The xdg backend is kept for users who manage a FreeDesktop.org style trash
+// themselves, e.g. under MSYS2.
+func newTrasher(backend string) (func(string) error, error) {
+	switch backend {
+	case "recyclebin":
+		if err := procSHFileOperationW.Find(); err != nil {
+			return nil, fmt.Errorf("error recycle bin unavailable: %w", err)
+		}
+		return recycle, nil
+	case "xdg":
+		return xdgTrash, nil
+	default:
+		return nil, fmt.Errorf("error invalid trash backend %q: must be one of %v", backend, trashBackends)
+	}
+}
+
+// recycle moves path to the Recycle Bin without showing any dialogs.
+// SHFileOperationW needs an absolute path without the \\?\ prefix, and pFrom
+// is a list terminated by an extra NUL. Without dialogs it would silently
+// delete files that cannot be recycled for good, so those are checked for
+// first and left alone.
+func recycle(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Lstat(abs)
+	if err != nil {
+		return err
+	}
+	var size int64
+	if info.Mode().IsRegular() {
+		size = info.Size()
+	}
+	if err := recycleBinFor(abs).check(size); err != nil {
+		return fmt.Errorf("recycle %s: %w", path, err)
+	}
+
+	from, err := syscall.UTF16FromString(abs)
+	if err != nil {
+		return err
+	}
+	from = append(from, 0)
+
+	op := shFileOpStruct{
+		wFunc:  foDelete,
+		pFrom:  &from[0],
+		fFlags: fofAllowUndo | fofNoConfirmation | fofSilent | fofNoErrorUI,
+	}
+
+	r, _, _ := procSHFileOperationW.Call(uintptr(unsafe.Pointer(&op)))
+	if r != 0 {
+		return fmt.Errorf("recycle %s: SHFileOperation failed with code %#x", path, r)
+	}
+	if op.aborted() {
+		return fmt.Errorf("recycle %s: operation aborted", path)
+	}
+
+	return nil
+}
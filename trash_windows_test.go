@@ -0,0 +1,92 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+)
+
+func TestSHFileOpStructLayout(t *testing.T) {
+	var op shFileOpStruct
+	want := map[string][2]uintptr{
+		// field: {32-bit offset, 64-bit offset}
+		"wFunc":                 {4, 8},
+		"pFrom":                 {8, 16},
+		"pTo":                   {12, 24},
+		"fFlags":                {16, 32},
+		"fAnyOperationsAborted": {18, 36},
+		"hNameMappings":         {22, 40},
+		"lpszProgressTitle":     {26, 48},
+	}
+	got := map[string]uintptr{
+		"wFunc":                 unsafe.Offsetof(op.wFunc),
+		"pFrom":                 unsafe.Offsetof(op.pFrom),
+		"pTo":                   unsafe.Offsetof(op.pTo),
+		"fFlags":                unsafe.Offsetof(op.fFlags),
+		"fAnyOperationsAborted": unsafe.Offsetof(op.fAnyOperationsAborted),
+		"hNameMappings":         unsafe.Offsetof(op.hNameMappings),
+		"lpszProgressTitle":     unsafe.Offsetof(op.lpszProgressTitle),
+	}
+	arch := 1
+	if unsafe.Sizeof(uintptr(0)) == 4 {
+		arch = 0
+	}
+	for field, offsets := range want {
+		if got[field] != offsets[arch] {
+			t.Errorf("offset of %s = %d, want %d", field, got[field], offsets[arch])
+		}
+	}
+}
+
+func TestRecycle(t *testing.T) {
+	trash, err := newTrasher("recyclebin")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "recycle-me.tmp")
+	if err := os.WriteFile(path, []byte("delly"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := trash(path); err != nil {
+		t.Fatalf("recycle: %v", err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("%s still exists after recycling it: %v", path, err)
+	}
+}
+
+func TestRecycleBinCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		bin  recycleBin
+		size int64
+		ok   bool
+	}{
+		{"unknown settings", recycleBin{}, 1 << 40, true},
+		{"fits", recycleBin{maxBytes: 1 << 20}, 1 << 20, true},
+		{"too large", recycleBin{maxBytes: 1 << 20}, 1<<20 + 1, false},
+		{"turned off", recycleBin{disabled: true, maxBytes: 1 << 30}, 1, false},
+		{"network drive", recycleBin{remote: true}, 1, false},
+		{"directory", recycleBin{maxBytes: 1 << 20}, 0, true},
+	}
+	for _, tt := range tests {
+		err := tt.bin.check(tt.size)
+		if tt.ok && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, errNotRecyclable) {
+			t.Errorf("%s: got %v, want errNotRecyclable", tt.name, err)
+		}
+	}
+}
+
+func TestNewTrasherInvalidBackend(t *testing.T) {
+	if _, err := newTrasher("bin"); err == nil {
+		t.Error("newTrasher accepted an unknown backend")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+)
+
+type treeNode struct {
+	size     int64
+	file     bool
+	children map[string]*treeNode
+}
+
+func (n *treeNode) child(name string) *treeNode {
+	if n.children == nil {
+		n.children = make(map[string]*treeNode)
+	}
+	c := n.children[name]
+	if c == nil {
+		c = &treeNode{}
+		n.children[name] = c
+	}
+	return c
+}
+
+// reportTree renders the matched files as an indented directory tree below
+// root, like the tree command, with each directory annotated with the total
+// size of the matches beneath it.
+func (m metadata) reportTree(out io.Writer, root string, opts listOptions) error {
+	top := &treeNode{}
+	for path, f := range m.fMeta {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("error building tree: %s is not below %s", path, root)
+		}
+
+		n := top
+		n.size += f.size
+		for _, name := range strings.Split(rel, string(filepath.Separator)) {
+			n = n.child(name)
+			n.size += f.size
+		}
+		n.file = true
+	}
+
+	if m.noTotal {
+		fmt.Fprintln(out, opts.display(root))
+	} else {
+		fmt.Fprintf(out, "%s (%s)\n", opts.display(root), humanize.Bytes(uint64(top.size)))
+	}
+	top.write(out, "", opts)
+	return nil
+}
+
+func (n *treeNode) write(out io.Writer, indent string, opts listOptions) {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		c := n.children[name]
+		branch, next := "├── ", "│   "
+		if i == len(names)-1 {
+			branch, next = "└── ", "    "
+		}
+
+		if c.file {
+			fmt.Fprintf(out, "%s%s%s  %s\n", indent, branch, opts.name(name), humanize.Bytes(uint64(c.size)))
+			continue
+		}
+		fmt.Fprintf(out, "%s%s%s/ (%s)\n", indent, branch, opts.name(name), humanize.Bytes(uint64(c.size)))
+		c.write(out, indent+next, opts)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/dustin/go-humanize"
+)
+
+// The change in free space may differ from the logical bytes deleted by
+// verifyTolerance of the deleted bytes, or verifySlack to account for block
+// rounding on small runs, before a warning is printed.
+const (
+	verifyTolerance = 0.1
+	verifySlack     = 1 << 20
+)
+
+func (m metadata) freed() int64 {
+	var n int64
+	for _, d := range m.dMeta {
+		n += d.bytesDeleted
+	}
+	return n
+}
+
+func reportVerify(out io.Writer, freed int64, before, after uint64) {
+	delta := int64(after) - int64(before)
+
+	fmt.Fprintf(out, "logical bytes saved:   %s\n", humanize.Bytes(uint64(freed)))
+	if delta < 0 {
+		fmt.Fprintf(out, "free space reclaimed: -%s\n\n", humanize.Bytes(uint64(-delta)))
+	} else {
+		fmt.Fprintf(out, "free space reclaimed:  %s\n\n", humanize.Bytes(uint64(delta)))
+	}
+
+	diff := delta - freed
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > verifySlack && float64(diff) > float64(freed)*verifyTolerance {
+		slog.Warn("free space did not change by the number of bytes deleted; "+
+			"hardlinks, sparse files, open files or delayed reclamation may be involved",
+			"free_space_delta", delta, "bytes_deleted", freed)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// minPathWidth is the narrowest a truncated path column gets, however
+// narrow the terminal.
+const minPathWidth = 20
+
+// terminalWidth returns the width of the terminal out writes to, or 0 when
+// out is not a terminal so that piped output is never truncated.
+func terminalWidth(out io.Writer) int {
+	f, ok := out.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return 0
+	}
+
+	width, _, err := term.GetSize(int(f.Fd()))
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// fitPath shortens path by replacing its middle with "..." so that it fits
+// in the terminal next to the other columns, which take up rest bytes.
+func (o listOptions) fitPath(path string, rest int) string {
+	if o.width == 0 {
+		return path
+	}
+	return truncateMiddle(path, max(o.width-rest, minPathWidth))
+}
+
+func truncateMiddle(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+
+	const ellipsis = "..."
+	keep := n - len(ellipsis)
+	head := keep / 2
+	tail := keep - head
+	return string(r[:head]) + ellipsis + string(r[len(r)-tail:])
+}